@@ -9,14 +9,20 @@ import (
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 
+	"github.com/justinsb/gitflow/pkg/cmd/absorb"
+	"github.com/justinsb/gitflow/pkg/cmd/checkout"
 	"github.com/justinsb/gitflow/pkg/cmd/cherry"
 	"github.com/justinsb/gitflow/pkg/cmd/forks"
+	"github.com/justinsb/gitflow/pkg/cmd/history"
 	"github.com/justinsb/gitflow/pkg/cmd/pr"
 	"github.com/justinsb/gitflow/pkg/cmd/prune"
 	"github.com/justinsb/gitflow/pkg/cmd/rebase"
+	"github.com/justinsb/gitflow/pkg/cmd/stack"
 	"github.com/justinsb/gitflow/pkg/cmd/stage"
+	"github.com/justinsb/gitflow/pkg/cmd/status"
 	"github.com/justinsb/gitflow/pkg/cmd/toc"
 	"github.com/justinsb/gitflow/pkg/cmd/top"
+	"github.com/justinsb/gitflow/pkg/cmd/where"
 	"github.com/justinsb/gitflow/pkg/cmd/workspaces"
 )
 
@@ -48,6 +54,12 @@ func Run(ctx context.Context) error {
 	cherry.AddCommand(ctx, root)
 	workspaces.AddCommand(ctx, root)
 	stage.AddCommand(ctx, root)
+	stack.AddCommand(ctx, root)
+	status.AddCommand(ctx, root)
+	checkout.AddCommand(ctx, root)
+	where.AddCommand(ctx, root)
+	absorb.AddCommand(ctx, root)
+	history.AddCommand(ctx, root)
 
 	return root.ExecuteContext(ctx)
 }
@@ -0,0 +1,239 @@
+package absorb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func AddCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "absorb",
+		Short: "turns staged changes into fixup! commits for the commits they belong to",
+		Long: `Turns staged changes into fixup! commits.
+
+For each staged hunk, we find the commit since upstream (the toc range) that last changed
+the lines the hunk modifies, and create a fixup! commit targeting it.  Hunks that touch
+lines from several commits, or lines from before the range, stay staged and are reported.
+
+With --rebase, we then run an autosquash rebase to fold the fixups into their commits.`,
+	}
+	var opt Options
+	opt.InitDefaults()
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return Run(cmd.Context(), opt)
+	}
+	cmd.Flags().BoolVar(&opt.DryRun, "dry-run", opt.DryRun, "preview only, don't make changes")
+	cmd.Flags().BoolVar(&opt.Rebase, "rebase", opt.Rebase, "run an autosquash rebase afterwards, if every hunk was absorbed")
+	parent.AddCommand(cmd)
+}
+
+type Options struct {
+	DryRun bool
+
+	// Rebase runs the autosquash rebase after creating the fixup commits
+	Rebase bool
+}
+
+func (o *Options) InitDefaults() {
+
+}
+
+func Run(ctx context.Context, opt Options) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	operation, err := repo.InProgressOperation(ctx)
+	if err != nil {
+		return err
+	}
+	if operation != "" {
+		return fmt.Errorf("a %s is in progress; finish or abort it first (%s)", operation, git.RecoveryHint(operation))
+	}
+
+	upstream, err := repo.FindUpstreamBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	base, commits, err := repo.ListBranchCommits(ctx, upstream)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("no commits since %s", upstream.Name)
+	}
+	inRange := make(map[string]*git.Commit)
+	for _, commit := range commits {
+		inRange[commit.SHA] = commit
+	}
+
+	diff, err := repo.ExecGit(ctx, "diff", "--cached", "-U0", "--no-color", "--no-ext-diff", "--no-renames")
+	if err != nil {
+		return err
+	}
+	hunks, err := git.ParseDiff(strings.NewReader(diff.Stdout))
+	if err != nil {
+		return err
+	}
+	if len(hunks) == 0 {
+		return fmt.Errorf("no staged changes")
+	}
+
+	// Assign each hunk to the commit it fixes
+	targets := make(map[*git.Hunk]*git.Commit)
+	groups := make(map[string][]*git.Hunk)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "HUNK\tRESULT\n")
+	for _, h := range hunks {
+		target, reason, err := findTarget(ctx, repo, inRange, h)
+		if err != nil {
+			return err
+		}
+		if target != nil {
+			targets[h] = target
+			groups[target.SHA] = append(groups[target.SHA], h)
+			fmt.Fprintf(w, "%s\tfixup %s %s\n", h.Location(), target.ShortSHA(), target.Subject)
+		} else {
+			fmt.Fprintf(w, "%s\tleft staged: %s\n", h.Location(), reason)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(groups) == 0 || opt.DryRun {
+		return nil
+	}
+
+	// Save the staged changes, so that whatever we don't absorb stays staged
+	writeTree, err := repo.ExecGit(ctx, "write-tree")
+	if err != nil {
+		return err
+	}
+	stagedTree := strings.TrimSpace(writeTree.Stdout)
+	restoreIndex := func() error {
+		if _, err := repo.ExecGit(ctx, "read-tree", stagedTree); err != nil {
+			return fmt.Errorf("error restoring staged changes (tree %s): %w", stagedTree, err)
+		}
+		return nil
+	}
+
+	if _, err := repo.ExecGit(ctx, "reset", "--quiet"); err != nil {
+		return err
+	}
+
+	applier := repo.NewHunkApplier(hunks)
+	fixups := 0
+	for _, commit := range commits {
+		group := groups[commit.SHA]
+		if len(group) == 0 {
+			continue
+		}
+		if err := applier.ApplyToIndex(ctx, group); err != nil {
+			if restoreErr := restoreIndex(); restoreErr != nil {
+				klog.Warningf("%v", restoreErr)
+			}
+			return err
+		}
+		if result, err := repo.ExecGit(ctx, "commit", "--quiet", "--no-verify", "--fixup="+commit.SHA); err != nil {
+			if result.ExitCode != 0 {
+				result.PrintOutput()
+			}
+			if restoreErr := restoreIndex(); restoreErr != nil {
+				klog.Warningf("%v", restoreErr)
+			}
+			return fmt.Errorf("error creating fixup commit for %s: %w", commit.ShortSHA(), err)
+		}
+		fixups++
+	}
+
+	if err := restoreIndex(); err != nil {
+		return err
+	}
+	fmt.Printf("created %d fixup commit(s)\n", fixups)
+
+	if opt.Rebase {
+		if len(targets) != len(hunks) {
+			fmt.Printf("not rebasing, as some changes are still staged\n")
+			return nil
+		}
+		// An interactive rebase with a no-op editor applies the autosquash todo as generated
+		if _, err := repo.ExecGitInteractive(ctx, "-c", "sequence.editor=true", "rebase", "-i", "--autosquash", base); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findTarget returns the commit in range that last changed the lines the hunk modifies,
+// or the reason we cannot choose one.
+func findTarget(ctx context.Context, repo *git.Repo, inRange map[string]*git.Commit, h *git.Hunk) (*git.Commit, string, error) {
+	p := h.OldPath()
+	if p == "" {
+		return nil, "new file", nil
+	}
+
+	var shas []string
+	r := h.Range
+	if r.OldLines != 0 {
+		blamed, err := repo.BlameLines(ctx, "HEAD", p, r.OldStart, r.OldStart+r.OldLines-1)
+		if err != nil {
+			klog.Warningf("cannot blame %s: %v", h.Location(), err)
+			return nil, "cannot blame", nil
+		}
+		shas = blamed
+	} else {
+		// A pure insertion belongs with the lines around it (after line OldStart)
+		start := r.OldStart
+		if start == 0 {
+			start = 1
+		}
+		blamed, err := repo.BlameLines(ctx, "HEAD", p, start, r.OldStart+1)
+		if err != nil {
+			// The insertion may be at the end of the file
+			blamed, err = repo.BlameLines(ctx, "HEAD", p, start, start)
+			if err != nil {
+				klog.Warningf("cannot blame %s: %v", h.Location(), err)
+				return nil, "cannot blame", nil
+			}
+		}
+		shas = blamed
+	}
+
+	distinct := make(map[string]bool)
+	for _, sha := range shas {
+		distinct[sha] = true
+	}
+	var target *git.Commit
+	outside := 0
+	for sha := range distinct {
+		if commit := inRange[sha]; commit != nil {
+			target = commit
+		} else {
+			outside++
+		}
+	}
+
+	switch {
+	case target == nil:
+		return nil, "lines were not changed since upstream", nil
+	case len(distinct) > 1 && outside == 0:
+		return nil, "ambiguous: lines were changed by several commits", nil
+	case outside != 0:
+		return nil, "ambiguous: lines were also changed before upstream", nil
+	}
+	return target, "", nil
+}
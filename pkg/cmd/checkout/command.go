@@ -0,0 +1,114 @@
+package checkout
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func AddCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "checkout <pr-number-or-url>",
+		Short: "Fetch a pull request and check it out as a local tracking branch",
+		Long: `Fetch a pull request from the contributor's fork and check it out locally.
+
+A remote named after the contributor is added if there isn't already a remote for their fork.
+The local branch is named pr-<number>, tracks the contributor's branch, and records
+the pull request number in branch.<name>.gitflow-pr.`,
+		Args: cobra.ExactArgs(1),
+		Example: `  # Check out pull request #1234 from upstream
+  gitflow checkout 1234
+
+  # Check out a pull request by url
+  gitflow checkout https://github.com/kubernetes/kops/pull/1234`,
+	}
+	var opt Options
+	opt.InitDefaults()
+
+	cmd.Flags().StringVar(&opt.Branch, "branch", opt.Branch, "name of the local branch (defaults to pr-<number>)")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return Run(cmd.Context(), opt, args[0])
+	}
+	parent.AddCommand(cmd)
+}
+
+type Options struct {
+	// Branch is the name of the local branch to create
+	Branch string
+}
+
+func (o *Options) InitDefaults() {
+
+}
+
+func Run(ctx context.Context, opt Options, prArg string) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	upstreamRemote, err := repo.FindUpstreamRemoteForPullRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	prNumber, err := upstreamRemote.ParsePullRequestID(ctx, prArg)
+	if err != nil {
+		return err
+	}
+
+	pr, err := upstreamRemote.GetPullRequest(ctx, prNumber)
+	if err != nil {
+		return err
+	}
+
+	localBranchName := opt.Branch
+	if localBranchName == "" {
+		localBranchName = "pr-" + prNumber
+	}
+
+	if _, err := repo.RevParse(ctx, "refs/heads/"+localBranchName); err == nil {
+		klog.Infof("branch %q already exists; checking it out", localBranchName)
+		if err := repo.Checkout(ctx, &git.Branch{Name: localBranchName, ShortName: localBranchName}); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if pr.HeadCloneURL() == "" {
+		// The fork has been deleted; we can still fetch the commits from upstream, but can't track them
+		klog.Warningf("repository for pull request #%s has been deleted; fetching from %s without tracking", prNumber, upstreamRemote.Name)
+		if _, err := repo.ExecGit(ctx, "fetch", upstreamRemote.Name, "pull/"+prNumber+"/head:refs/heads/"+localBranchName); err != nil {
+			return err
+		}
+		if err := repo.Checkout(ctx, &git.Branch{Name: localBranchName, ShortName: localBranchName}); err != nil {
+			return err
+		}
+	} else {
+		headRemote, err := repo.FindOrAddRemote(ctx, pr.HeadOwner(), pr.HeadCloneURL())
+		if err != nil {
+			return err
+		}
+
+		if err := headRemote.FetchBranch(ctx, pr.HeadBranch()); err != nil {
+			return err
+		}
+
+		headBranch := &git.Branch{Name: headRemote.Name + "/" + pr.HeadBranch(), ShortName: pr.HeadBranch(), Remote: headRemote}
+		if _, err := repo.CheckoutTrackingBranch(ctx, localBranchName, headBranch); err != nil {
+			return err
+		}
+	}
+
+	if err := repo.SetBranchPullRequest(ctx, localBranchName, prNumber); err != nil {
+		return err
+	}
+
+	fmt.Printf("checked out #%s (%s) as %q\n", prNumber, pr.Title(), localBranchName)
+	return nil
+}
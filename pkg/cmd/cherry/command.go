@@ -1,59 +1,121 @@
 package cherry
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
 
 	"github.com/justinsb/gitflow/pkg/git"
 )
 
 func AddCommand(ctx context.Context, parent *cobra.Command) {
 	cmd := &cobra.Command{
-		Use:   "cherry <pr-number>",
+		Use:   "cherry <pr-number|commit|range|branch>...",
 		Short: "Cherry-pick a pull request from upstream to current branch",
 		Long: `Cherry-pick a pull request from the upstream repository to the current branch.
 
-This command will:
-1. Create a new branch based on the current branch (or specified branch)
-2. Cherry-pick all commits from the specified pull request
+Instead of a pull request, you can also cherry-pick commits, ranges (a..b) or the
+commits on a local branch (since upstream).  The title and body are then built
+from the commit subjects.  A number of 7 or more digits that names a commit is
+treated as a commit; use #<pr-number> to force a pull request.
+
+This command will, for each target branch:
+1. Create a new branch based on the freshly fetched upstream target branch
+2. Cherry-pick the commits that landed for the pull request (the squash commit,
+   the rebased commits, or the merge commit with -m 1), or the original commits
+   if the pull request is not merged.  Commits already on the target branch
+   (matched by patch-id, like git cherry) are skipped.
 3. Push the new branch to your fork
 4. Create a new pull request for the cherry-picked changes
 5. Switch back to the original branch
 
+Target branches can be listed (--branch a,b or repeated --branch flags) or given
+as glob patterns, which are matched against the upstream remote's branches.
+Targets must exist on the upstream remote.
+A failure on one target does not stop the others; a summary is printed at the end.
+
+When a cherry-pick conflicts, the earlier upstream changes that touched the conflicting
+lines (and are not on the target branch) are listed as candidate prerequisites.
+With --with-prerequisites, the cherry-pick is retried with those changes included.
+
 The new branch will be named: automated-cherry-pick-of-#<pr-number>-<target-branch>
-The new pull request will reference the original PR and include appropriate metadata.`,
-		Args: cobra.ExactArgs(1),
+(or automated-cherry-pick-of-<short-sha>-<target-branch> when cherry-picking commits)
+The new pull request will reference the original PR and include appropriate metadata:
+the release-note block and kind/sig labels are copied from the original PR.
+
+The title and body are Go templates, configurable with gitflow.cherry.title-template
+and gitflow.cherry.body-template-file; the labels to copy are configurable with
+(multi-valued) gitflow.cherry.label.`,
+		Args: cobra.MinimumNArgs(1),
 		Example: `  # Cherry-pick PR #1234 from upstream to current branch
   srctool cherry 1234
 
   # Cherry-pick PR #1234 from upstream to release-1.32 branch
-  srctool cherry 1234 --branch release-1.32`,
+  srctool cherry 1234 --branch release-1.32
+
+  # Cherry-pick PR #1234 from upstream to every release-1.3x branch
+  srctool cherry 1234 --branch 'release-1.3*'
+
+  # Cherry-pick two commits that never had their own PR to release-1.32
+  srctool cherry 0a1b2c3d 4e5f6a7b --branch release-1.32`,
 	}
 	var opt Options
 	opt.InitDefaults()
 
-	cmd.Flags().StringVar(&opt.Branch, "branch", "", "Target branch to cherry-pick to (defaults to current branch)")
+	cmd.Flags().BoolVar(&opt.IncludePrerequisites, "with-prerequisites", opt.IncludePrerequisites, "On conflict, include the upstream changes the cherry-pick appears to depend on")
+	cmd.Flags().StringSliceVar(&opt.Branches, "branch", opt.Branches, "Target branches or patterns to cherry-pick to (defaults to current branch)")
+
+	var autostash bool
+	cmd.Flags().BoolVar(&autostash, "autostash", autostash, "Stash uncommitted changes and restore them afterwards (default from gitflow.autostash)")
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		return Run(cmd.Context(), opt, args[0])
+		if cmd.Flags().Changed("autostash") {
+			opt.Autostash = &autostash
+		}
+		return Run(cmd.Context(), opt, args)
 	}
 	parent.AddCommand(cmd)
 }
 
 type Options struct {
-	Branch string
+	// Branches are the target branches, or glob patterns matching upstream branches
+	Branches []string
+
+	// IncludePrerequisites retries a conflicting cherry-pick with the upstream changes it appears to depend on
+	IncludePrerequisites bool
+
+	// Autostash, if set, overrides the gitflow.autostash setting
+	Autostash *bool
 }
 
 func (o *Options) InitDefaults() {
-	o.Branch = ""
+	o.Branches = nil
+}
+
+// Outcome is the result of cherry-picking to one target branch
+type Outcome string
+
+const (
+	OutcomeSuccess         Outcome = "success"
+	OutcomeConflict        Outcome = "conflict"
+	OutcomeAlreadyContains Outcome = "already-contains"
+	OutcomeError           Outcome = "error"
+)
+
+type targetResult struct {
+	Target  *git.Branch
+	Outcome Outcome
+	Detail  string
 }
 
-func Run(ctx context.Context, opt Options, prNumber string) error {
+func Run(ctx context.Context, opt Options, args []string) error {
 
 	repo, err := git.OpenRepo(ctx)
 	if err != nil {
@@ -71,68 +133,312 @@ func Run(ctx context.Context, opt Options, prNumber string) error {
 		return err
 	}
 
-	var targetBranch *git.Branch
-	if opt.Branch != "" {
-		// Use the specified branch
-		targetBranch = &git.Branch{Name: opt.Branch, ShortName: opt.Branch}
-	} else {
-		// Use current branch
-		targetBranch, err = repo.CurrentBranch(ctx)
-		if err != nil {
-			return err
-		}
+	preflight, err := repo.Preflight(ctx, git.PreflightOptions{Autostash: opt.Autostash})
+	if err != nil {
+		return err
 	}
+	defer preflight.Restore(ctx)
 
-	prBranchName := "automated-cherry-pick-of-#" + prNumber + "-" + targetBranch.Name
-
-	// if err := targetBranch.Remote.Fetch(ctx); err != nil {
-	// 	return err
-	// }
-
-	if _, err := repo.CheckoutNewBranch(ctx, prBranchName, targetBranch); err != nil {
+	originalBranch, err := repo.CurrentBranch(ctx)
+	if err != nil {
 		return err
 	}
 
-	pr, err := upstream.Remote.GetPullRequest(ctx, prNumber)
+	targetBranches, err := resolveTargets(ctx, repo, upstream.Remote, opt.Branches, originalBranch)
 	if err != nil {
 		return err
 	}
 
-	if err := repo.CherryPick(ctx, pr.Commits()); err != nil {
+	src, err := resolveSource(ctx, repo, upstream, args)
+	if err != nil {
 		return err
 	}
 
-	if err := repo.Push(ctx, forkRemote, git.PushOptions{SetUpstream: true}); err != nil {
+	tmpl, err := loadTemplates(ctx, repo)
+	if err != nil {
 		return err
 	}
 
-	title := fmt.Sprintf("Automated cherry pick of #" + prNumber + ": " + pr.Title() + "\n")
-	var body bytes.Buffer
-	body.WriteString(fmt.Sprintf("Cherry pick of #" + prNumber + " on " + targetBranch.Name + "\n"))
-	body.WriteString(fmt.Sprintf("\n"))
-	body.WriteString(fmt.Sprintf("#" + prNumber + ":" + pr.Title() + "\n"))
+	c := &cherryPick{
+		repo:       repo,
+		forkRemote: forkRemote,
+		upstream:   upstream,
+		src:        src,
+		templates:  tmpl,
+
+		includePrerequisites: opt.IncludePrerequisites,
+	}
 
-	{
-		forkRemoteGithubName := "justinsb" // TODO: extract from https://github.com/justinsb/foo.git or git@github.com/justinsb/foo.git
-		args := []string{"gh", "pr", "create", "--base", targetBranch.ShortName, "--head", forkRemoteGithubName + ":" + prBranchName, "--title", title, "--body-file", "-"}
-		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = &body
+	var results []*targetResult
+	for _, targetBranch := range targetBranches {
+		result := c.pickTo(ctx, targetBranch)
+		results = append(results, result)
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("error running %s: %w", args, err)
+		// Switch back to the original branch, ready for the next target
+		if err := repo.Checkout(ctx, originalBranch); err != nil {
+			return err
 		}
 	}
 
-	// Switch back to the original branch (current branch, not target branch)
-	originalBranch, err := repo.CurrentBranch(ctx)
-	if err != nil {
-		return err
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "BRANCH\tRESULT\tDETAIL\n")
+	failed := 0
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Target.ShortName, result.Outcome, result.Detail)
+		if result.Outcome == OutcomeConflict || result.Outcome == OutcomeError {
+			failed++
+		}
 	}
-	if err := repo.Checkout(ctx, originalBranch); err != nil {
+	if err := w.Flush(); err != nil {
 		return err
 	}
 
+	if failed != 0 {
+		return fmt.Errorf("cherry-pick failed for %d of %d branches", failed, len(results))
+	}
 	return nil
 }
+
+// resolveTargets expands the branch arguments into target branches on the upstream remote.
+func resolveTargets(ctx context.Context, repo *git.Repo, upstreamRemote *git.Remote, branchArgs []string, currentBranch *git.Branch) ([]*git.Branch, error) {
+	// Always work from the latest upstream branches, not a (possibly stale) local branch
+	if err := upstreamRemote.Fetch(ctx); err != nil {
+		return nil, err
+	}
+	upstreamBranches, err := upstreamRemote.ListBranches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(branchArgs) == 0 {
+		branchArgs = []string{currentBranch.ShortName}
+	}
+
+	isPattern := func(s string) bool { return strings.ContainsAny(s, "*?[") }
+
+	seen := make(map[string]bool)
+	var targets []*git.Branch
+	for _, arg := range branchArgs {
+		var matches []*git.Branch
+		for _, branch := range upstreamBranches {
+			if isPattern(arg) {
+				match, err := path.Match(arg, branch.ShortName)
+				if err != nil {
+					return nil, fmt.Errorf("invalid branch pattern %q: %w", arg, err)
+				}
+				if match {
+					matches = append(matches, branch)
+				}
+			} else if branch.ShortName == arg {
+				matches = append(matches, branch)
+			}
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no branches on %q match %q; release branches are: %s", upstreamRemote.Name, arg, strings.Join(releaseBranchNames(ctx, repo, upstreamBranches), ", "))
+		}
+		sort.Slice(matches, func(i, j int) bool { return matches[i].ShortName < matches[j].ShortName })
+		for _, match := range matches {
+			if !seen[match.ShortName] {
+				seen[match.ShortName] = true
+				targets = append(targets, match)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// releaseBranchNames returns the names of the branches that look like release branches, for suggestions.
+func releaseBranchNames(ctx context.Context, repo *git.Repo, branches []*git.Branch) []string {
+	releasePatterns, err := repo.ReleaseBranchPatterns(ctx)
+	if err != nil {
+		klog.Warningf("%v", err)
+		return nil
+	}
+	var names []string
+	for _, branch := range releasePatterns.Filter(branches) {
+		names = append(names, branch.ShortName)
+	}
+	return names
+}
+
+// cherryPick holds the state for cherry-picking one pull request to several target branches
+type cherryPick struct {
+	repo       *git.Repo
+	forkRemote *git.Remote
+	upstream   *git.Branch
+
+	src *source
+
+	// includePrerequisites controls whether we retry conflicting picks with their prerequisites
+	includePrerequisites bool
+
+	templates *templates
+}
+
+// pickTo creates the cherry-pick branch and pull request for one target branch.
+func (c *cherryPick) pickTo(ctx context.Context, targetBranch *git.Branch) *targetResult {
+	repo := c.repo
+	landed := c.src.Landed
+
+	result := &targetResult{Target: targetBranch}
+
+	// Skip any commits that are already on the target, for example from a partial manual backport
+	var shas []string
+	var skipped []string
+	present, err := repo.FindPresentCommits(ctx, landed, targetBranch.Name)
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Detail = err.Error()
+		return result
+	}
+	for _, sha := range landed.SHAs {
+		if _, found := present[sha]; found {
+			skipped = append(skipped, shortSHA(sha))
+		} else {
+			shas = append(shas, sha)
+		}
+	}
+	if len(shas) == 0 {
+		result.Outcome = OutcomeAlreadyContains
+		result.Detail = "already backported"
+		return result
+	}
+	if len(skipped) != 0 {
+		klog.Infof("skipping commits already on %q: %v", targetBranch.ShortName, skipped)
+	}
+
+	prBranchName := "automated-cherry-pick-of-" + c.src.ID + "-" + targetBranch.ShortName
+
+	if _, err := repo.CheckoutNewBranch(ctx, prBranchName, targetBranch); err != nil {
+		result.Outcome = OutcomeError
+		result.Detail = err.Error()
+		return result
+	}
+
+	// -x records the source commit in each message, for provenance
+	var included []*prerequisite
+	pickErr := repo.CherryPickWithOptions(ctx, shas, git.CherryPickOptions{Mainline: landed.Mainline, RecordOrigin: true})
+	if pickErr != nil {
+		klog.Warningf("cherry-pick onto %q failed: %v", targetBranch.ShortName, pickErr)
+
+		// Look for the earlier upstream changes that this one probably depends on, while the conflict is in place
+		prerequisites, err := c.findPrerequisites(ctx, targetBranch)
+		if err != nil {
+			klog.Warningf("unable to determine prerequisites: %v", err)
+		}
+		if _, err := repo.ExecGit(ctx, "cherry-pick", "--abort"); err != nil {
+			klog.Warningf("error aborting cherry-pick: %v", err)
+		}
+		if len(prerequisites) != 0 {
+			fmt.Printf("cherry-pick onto %q conflicted; candidate prerequisites:\n", targetBranch.ShortName)
+			for _, p := range prerequisites {
+				fmt.Printf("  %s\n", p)
+			}
+		}
+
+		if c.includePrerequisites && len(prerequisites) != 0 {
+			// Try again from the target, picking the prerequisites first
+			_, pickErr = repo.ExecGit(ctx, "reset", "--hard", targetBranch.Name)
+			if pickErr == nil {
+				pickErr = c.pickPrerequisites(ctx, prerequisites)
+			}
+			if pickErr == nil {
+				pickErr = repo.CherryPickWithOptions(ctx, shas, git.CherryPickOptions{Mainline: landed.Mainline, RecordOrigin: true})
+			}
+			if pickErr == nil {
+				included = prerequisites
+			} else {
+				klog.Warningf("cherry-pick with prerequisites onto %q failed: %v", targetBranch.ShortName, pickErr)
+				if _, err := repo.ExecGit(ctx, "cherry-pick", "--abort"); err != nil {
+					klog.Warningf("error aborting cherry-pick: %v", err)
+				}
+			}
+		}
+
+		if pickErr != nil {
+			result.Outcome = OutcomeConflict
+			result.Detail = "cherry-pick failed; branch " + prBranchName + " removed"
+			if len(prerequisites) != 0 {
+				var ids []string
+				for _, p := range prerequisites {
+					ids = append(ids, p.ID())
+				}
+				result.Detail += "; candidate prerequisites: " + strings.Join(ids, ",")
+			}
+			if _, err := repo.ExecGit(ctx, "checkout", "-"); err != nil {
+				klog.Warningf("error switching back from %q: %v", prBranchName, err)
+			} else if err := repo.DeleteBranch(ctx, prBranchName); err != nil {
+				klog.Warningf("error deleting branch %q: %v", prBranchName, err)
+			}
+			return result
+		}
+	}
+
+	// The new branch tracks the upstream target, so we name what we push explicitly
+	if err := repo.Push(ctx, c.forkRemote, git.PushOptions{SetUpstream: true, Refspecs: []string{prBranchName}}); err != nil {
+		result.Outcome = OutcomeError
+		result.Detail = err.Error()
+		return result
+	}
+
+	forkInfo, err := c.forkRemote.GithubInfo(ctx)
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Detail = err.Error()
+		return result
+	}
+
+	data := &templateData{
+		ID:           c.src.ID,
+		Title:        c.src.Title(),
+		TargetBranch: targetBranch.ShortName,
+	}
+	for _, commit := range c.src.Commits {
+		data.Commits = append(data.Commits, templateCommit{SHA: commit.SHA, ShortSHA: commit.ShortSHA(), Subject: commit.Subject})
+	}
+	for _, p := range included {
+		data.Prerequisites = append(data.Prerequisites, p.ID())
+	}
+	if pr := c.src.PR; pr != nil {
+		data.Number = c.src.PRNumber
+		data.URL = pr.URL()
+		data.ReleaseNote = extractReleaseNote(pr.Body())
+		data.Labels = c.templates.selectLabels(pr.Labels())
+	}
+	title, body, err := c.templates.render(data)
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Detail = err.Error()
+		return result
+	}
+
+	newPR, newPRURL, err := c.upstream.Remote.CreatePullRequest(ctx, git.CreatePullRequestOptions{
+		Base:   targetBranch.ShortName,
+		Head:   forkInfo.Organization + ":" + prBranchName,
+		Title:  title,
+		Body:   body,
+		Labels: data.Labels,
+	})
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Detail = err.Error()
+		return result
+	}
+
+	result.Outcome = OutcomeSuccess
+	result.Detail = fmt.Sprintf("#%d %s", newPR, newPRURL)
+	if len(skipped) != 0 {
+		result.Detail += fmt.Sprintf(" (skipped %s, already present)", strings.Join(skipped, ","))
+	}
+	if len(included) != 0 {
+		result.Detail += fmt.Sprintf(" (with prerequisites %s)", strings.Join(data.Prerequisites, ","))
+	}
+	return result
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
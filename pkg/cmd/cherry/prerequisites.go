@@ -0,0 +1,211 @@
+package cherry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// prerequisite is an upstream change that a conflicting cherry-pick probably depends on
+type prerequisite struct {
+	// PR is the pull request that introduced the change, if we found one
+	PR *git.GithubPullRequest
+
+	// Commits are the upstream commits that touched the conflicting lines, in order
+	Commits []string
+
+	// order is the position of the first commit in upstream history, for sorting
+	order int
+}
+
+// ID identifies the prerequisite: #<number> for a pull request, otherwise the short shas
+func (p *prerequisite) ID() string {
+	if p.PR != nil {
+		return fmt.Sprintf("#%d", p.PR.Number())
+	}
+	var shas []string
+	for _, sha := range p.Commits {
+		shas = append(shas, shortSHA(sha))
+	}
+	return strings.Join(shas, ",")
+}
+
+func (p *prerequisite) String() string {
+	if p.PR != nil {
+		return p.ID() + " " + p.PR.Title()
+	}
+	return p.ID()
+}
+
+// findPrerequisites is called when a cherry-pick stops with conflicts.
+// It finds the upstream commits that touched the conflicting hunks since the target branch forked,
+// and that are not already on the target branch, and maps them to their pull requests.
+func (c *cherryPick) findPrerequisites(ctx context.Context, targetBranch *git.Branch) ([]*prerequisite, error) {
+	repo := c.repo
+
+	pickSHA, err := repo.RevParse(ctx, "CHERRY_PICK_HEAD")
+	if err != nil {
+		return nil, err
+	}
+	mainline := c.src.Landed.Mainline
+	if mainline == 0 {
+		mainline = 1
+	}
+	parent := pickSHA + "^" + strconv.Itoa(mainline)
+
+	files, err := repo.ConflictedFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	mergeBase, err := repo.MergeBase(ctx, parent, targetBranch.Name)
+	if err != nil {
+		return nil, err
+	}
+	historyRange := mergeBase + ".." + parent
+
+	candidates := make(map[string]bool)
+	for _, file := range files {
+		diff, err := repo.ExecGit(ctx, "diff", "-U0", "--no-color", parent, pickSHA, "--", file)
+		if err != nil {
+			return nil, err
+		}
+
+		// Look for the commits that touched the lines the pick changes (in the pre-image)
+		var logArgs [][]string
+		for _, line := range strings.Split(diff.Stdout, "\n") {
+			if !strings.HasPrefix(line, "@@") {
+				continue
+			}
+			hunk, err := git.ParseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			start := hunk.OldStart
+			end := hunk.OldStart + hunk.OldLines - 1
+			if hunk.OldLines == 0 {
+				// A pure insertion is positioned after OldStart
+				if start == 0 {
+					start = 1
+				}
+				end = start
+			}
+			logArgs = append(logArgs, []string{"-L", fmt.Sprintf("%d,%d:%s", start, end, file)})
+		}
+		if len(logArgs) == 0 {
+			// No line information (e.g. a binary file); use every commit that touched the file
+			logArgs = append(logArgs, []string{"--", file})
+		}
+
+		for _, extra := range logArgs {
+			args := []string{"log", "--format=%H", "-s", "--no-merges", historyRange}
+			args = append(args, extra...)
+			result, err := repo.ExecGit(ctx, args...)
+			if err != nil {
+				klog.Warningf("error finding history of %s: %v", file, err)
+				continue
+			}
+			for _, sha := range strings.Fields(result.Stdout) {
+				candidates[sha] = true
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// Ignore changes that were already backported
+	targetPatchIDs, err := repo.PatchIDs(ctx, mergeBase+".."+targetBranch.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Order by upstream history, oldest first
+	order := make(map[string]int)
+	history, err := repo.ExecGit(ctx, "rev-list", "--reverse", historyRange)
+	if err != nil {
+		return nil, err
+	}
+	for i, sha := range strings.Fields(history.Stdout) {
+		order[sha] = i
+	}
+
+	byPR := make(map[int]*prerequisite)
+	var prerequisites []*prerequisite
+	for sha := range candidates {
+		patchID, err := repo.CommitPatchID(ctx, sha, 0)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := targetPatchIDs[patchID]; found && patchID != "" {
+			continue
+		}
+
+		var pr *git.GithubPullRequest
+		prs, err := c.upstream.Remote.FindPullRequestsForCommit(ctx, sha)
+		if err != nil {
+			klog.Warningf("unable to map commit %s to a pull request: %v", sha, err)
+		}
+		for _, candidate := range prs {
+			if candidate.Merged() {
+				pr = candidate
+				break
+			}
+		}
+
+		if pr == nil {
+			prerequisites = append(prerequisites, &prerequisite{Commits: []string{sha}, order: order[sha]})
+			continue
+		}
+		p := byPR[pr.Number()]
+		if p == nil {
+			p = &prerequisite{PR: pr, order: order[sha]}
+			byPR[pr.Number()] = p
+			prerequisites = append(prerequisites, p)
+		}
+		p.Commits = append(p.Commits, sha)
+		if order[sha] < p.order {
+			p.order = order[sha]
+		}
+	}
+
+	for _, p := range prerequisites {
+		sort.Slice(p.Commits, func(i, j int) bool { return order[p.Commits[i]] < order[p.Commits[j]] })
+	}
+	sort.Slice(prerequisites, func(i, j int) bool { return prerequisites[i].order < prerequisites[j].order })
+	return prerequisites, nil
+}
+
+// pickPrerequisites cherry-picks the prerequisites onto the current branch, oldest first.
+func (c *cherryPick) pickPrerequisites(ctx context.Context, prerequisites []*prerequisite) error {
+	for _, p := range prerequisites {
+		shas := p.Commits
+		mainline := 0
+		if p.PR != nil {
+			// Pick the whole pull request, as it landed
+			pr, err := c.upstream.Remote.GetPullRequest(ctx, strconv.Itoa(p.PR.Number()))
+			if err != nil {
+				return err
+			}
+			landed, err := c.repo.FindLandedCommits(ctx, c.upstream.Remote, pr)
+			if err != nil {
+				return err
+			}
+			shas = landed.SHAs
+			mainline = landed.Mainline
+		}
+		if err := c.repo.CherryPickWithOptions(ctx, shas, git.CherryPickOptions{Mainline: mainline, RecordOrigin: true}); err != nil {
+			return fmt.Errorf("error cherry-picking prerequisite %s: %w", p, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package cherry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// source is what we are cherry-picking: either a pull request, or a list of commits
+type source struct {
+	// ID identifies the source in titles and branch names: #<number> for a pull request, or a short sha
+	ID string
+
+	// PR is the pull request, if we are cherry-picking a pull request
+	PR       *git.GithubPullRequest
+	PRNumber string
+
+	// Commits are the commits being cherry-picked, when not cherry-picking a pull request
+	Commits []*git.Commit
+
+	// Landed are the commits we will cherry-pick
+	Landed *git.LandedCommits
+}
+
+// Title returns a one-line summary of the source
+func (s *source) Title() string {
+	if s.PR != nil {
+		return s.PR.Title()
+	}
+	title := s.Commits[0].Subject
+	if len(s.Commits) > 1 {
+		title += fmt.Sprintf(" (and %d more)", len(s.Commits)-1)
+	}
+	return title
+}
+
+// resolveSource interprets the arguments as a pull request number (or url),
+// or as a list of commits, ranges (a..b) and branches.
+func resolveSource(ctx context.Context, repo *git.Repo, upstream *git.Branch, args []string) (*source, error) {
+	if len(args) == 1 && isPullRequestArg(ctx, repo, args[0]) {
+		prNumber, err := upstream.Remote.ParsePullRequestID(ctx, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return resolvePullRequest(ctx, repo, upstream, prNumber)
+	}
+
+	var commits []*git.Commit
+	for _, arg := range args {
+		var logArgs []string
+		if strings.Contains(arg, "..") {
+			logArgs = []string{arg}
+		} else if _, err := repo.RevParse(ctx, "refs/heads/"+arg); err == nil {
+			// A branch means the commits on that branch
+			logArgs = []string{upstream.Name + ".." + "refs/heads/" + arg}
+		} else {
+			logArgs = []string{"--no-walk", arg}
+		}
+		found, err := repo.ListCommits(ctx, logArgs...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve commits for %q: %w", arg, err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no commits found for %q", arg)
+		}
+		commits = append(commits, found...)
+	}
+
+	landed := &git.LandedCommits{}
+	for _, commit := range commits {
+		landed.SHAs = append(landed.SHAs, commit.SHA)
+	}
+	if len(commits) == 1 {
+		parents, err := repo.CommitParents(ctx, commits[0].SHA)
+		if err != nil {
+			return nil, err
+		}
+		if len(parents) > 1 {
+			landed.Mainline = 1
+		}
+	}
+
+	return &source{
+		ID:      commits[len(commits)-1].ShortSHA(),
+		Commits: commits,
+		Landed:  landed,
+	}, nil
+}
+
+// isPullRequestArg returns true if the argument refers to a pull request rather than a commit:
+// a url, #<number>, or a number that is too short to be an abbreviated sha or isn't a commit.
+func isPullRequestArg(ctx context.Context, repo *git.Repo, arg string) bool {
+	if strings.HasPrefix(arg, "#") || strings.Contains(arg, "://") {
+		return true
+	}
+	for _, c := range arg {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	if len(arg) < 7 {
+		return true
+	}
+	// All-digit short shas are possible; prefer the commit if there is one
+	_, err := repo.RevParse(ctx, arg)
+	return err != nil
+}
+
+func resolvePullRequest(ctx context.Context, repo *git.Repo, upstream *git.Branch, prNumber string) (*source, error) {
+	pr, err := upstream.Remote.GetPullRequest(ctx, prNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick what actually landed upstream, which differs from the PR commits for squash and rebase merges
+	landed, err := repo.FindLandedCommits(ctx, upstream.Remote, pr)
+	if err != nil {
+		return nil, err
+	}
+	if landed.Method == git.MergeMethodUnmerged {
+		klog.Warningf("pull request #%s is not merged; cherry-picking its original commits", prNumber)
+	} else {
+		klog.Infof("pull request #%s was merged by %s; cherry-picking %v", prNumber, landed.Method, landed.SHAs)
+	}
+
+	return &source{
+		ID:       "#" + prNumber,
+		PR:       pr,
+		PRNumber: prNumber,
+		Landed:   landed,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package cherry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// defaultTitleTemplate is used unless gitflow.cherry.title-template is set
+const defaultTitleTemplate = `Automated cherry pick of {{.ID}}: {{.Title}}`
+
+// defaultBodyTemplate is used unless gitflow.cherry.body-template-file is set
+const defaultBodyTemplate = `Cherry pick of {{.ID}} on {{.TargetBranch}}.
+
+{{if .Number}}#{{.Number}}: {{.Title}}
+{{else}}{{range .Commits}}{{.ShortSHA}}: {{.Subject}}
+{{end}}{{end}}{{if .Prerequisites}}
+Includes prerequisites:{{range .Prerequisites}} {{.}}{{end}}
+{{end}}
+` + "```release-note" + `
+{{if .ReleaseNote}}{{.ReleaseNote}}{{else}}NONE{{end}}
+` + "```" + `
+`
+
+// defaultLabelPatterns are the labels copied from the original pull request, unless gitflow.cherry.label is set
+var defaultLabelPatterns = []string{"kind/*", "sig/*"}
+
+// templateData is the data available to the title and body templates
+type templateData struct {
+	// ID identifies what we are cherry-picking: #<number> for a pull request, or a short sha
+	ID string
+	// Number is the number of the original pull request, or "" when cherry-picking commits
+	Number string
+	// Title is the title of the original pull request, or the subject of the first commit
+	Title string
+	// URL is the url of the original pull request
+	URL string
+	// TargetBranch is the branch we are cherry-picking to
+	TargetBranch string
+	// ReleaseNote is the contents of the release-note block of the original pull request
+	ReleaseNote string
+	// Labels are the labels copied from the original pull request
+	Labels []string
+	// Commits are the commits being cherry-picked, when not cherry-picking a pull request
+	Commits []templateCommit
+	// Prerequisites are the earlier changes that were included to resolve conflicts
+	Prerequisites []string
+}
+
+type templateCommit struct {
+	SHA      string
+	ShortSHA string
+	Subject  string
+}
+
+type templates struct {
+	title         *template.Template
+	body          *template.Template
+	labelPatterns []string
+}
+
+func loadTemplates(ctx context.Context, repo *git.Repo) (*templates, error) {
+	config, err := repo.ListConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting repo config: %w", err)
+	}
+
+	titleText := config.Get("gitflow.cherry.title-template")
+	if titleText == "" {
+		titleText = defaultTitleTemplate
+	}
+	title, err := template.New("title").Parse(titleText)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing gitflow.cherry.title-template: %w", err)
+	}
+
+	bodyText := defaultBodyTemplate
+	if p := config.Get("gitflow.cherry.body-template-file"); p != "" {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("error reading gitflow.cherry.body-template-file %q: %w", p, err)
+		}
+		bodyText = string(b)
+	}
+	body, err := template.New("body").Parse(bodyText)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing body template: %w", err)
+	}
+
+	labelPatterns := config.GetAll("gitflow.cherry.label")
+	if len(labelPatterns) == 0 {
+		labelPatterns = defaultLabelPatterns
+	}
+
+	return &templates{title: title, body: body, labelPatterns: labelPatterns}, nil
+}
+
+// render builds the title and body of the cherry-pick pull request
+func (t *templates) render(data *templateData) (string, string, error) {
+	var title bytes.Buffer
+	if err := t.title.Execute(&title, data); err != nil {
+		return "", "", fmt.Errorf("error rendering title: %w", err)
+	}
+	var body bytes.Buffer
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("error rendering body: %w", err)
+	}
+	return strings.TrimSpace(title.String()), body.String(), nil
+}
+
+// selectLabels returns the labels that match any of the label patterns
+func (t *templates) selectLabels(labels []string) []string {
+	var selected []string
+	for _, label := range labels {
+		for _, pattern := range t.labelPatterns {
+			if match, _ := path.Match(pattern, label); match {
+				selected = append(selected, label)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+var releaseNoteRegex = regexp.MustCompile("(?s)```release-note[ \t]*\r?\n(.*?)```")
+
+// extractReleaseNote returns the contents of the release-note block in a pull request body, or "".
+func extractReleaseNote(body string) string {
+	match := releaseNoteRegex.FindStringSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(match[1])
+}
@@ -0,0 +1,160 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// AddCommand adds the commands that rewrite the commits listed by toc, addressed by their index.
+func AddCommand(ctx context.Context, parent *cobra.Command) {
+	addDropCommand(ctx, parent)
+	addMoveCommand(ctx, parent)
+	addRewordCommand(ctx, parent)
+	addSquashCommand(ctx, parent)
+	addSplitCommand(ctx, parent)
+}
+
+// RewriteOptions are the options shared by the history rewriting commands
+type RewriteOptions struct {
+	// Autostash, if set, overrides the gitflow.autostash setting
+	Autostash *bool
+}
+
+// addAutostashFlag adds the --autostash flag, which is applied to opt only if set on the command line
+func addAutostashFlag(cmd *cobra.Command, opt *RewriteOptions) {
+	var autostash bool
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("autostash") {
+			opt.Autostash = &autostash
+		}
+		return run(cmd, args)
+	}
+	cmd.Flags().BoolVar(&autostash, "autostash", autostash, "stash uncommitted changes and restore them afterwards (default from gitflow.autostash)")
+}
+
+// branchHistory is the commits since upstream (the toc range), opened for rewriting
+type branchHistory struct {
+	repo      *git.Repo
+	preflight *git.Preflight
+
+	// base is the merge base with upstream, onto which we rebase
+	base string
+
+	// commits are the commits since upstream, oldest first
+	commits []*git.Commit
+}
+
+// openBranchHistory runs the preflight checks and lists the commits since upstream.
+// Close must be called when done, to restore any stashed changes.
+func openBranchHistory(ctx context.Context, opt RewriteOptions) (*branchHistory, error) {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := repo.FindUpstreamBranch(ctx)
+	if err != nil {
+		repo.Close()
+		return nil, err
+	}
+
+	preflight, err := repo.Preflight(ctx, git.PreflightOptions{Autostash: opt.Autostash})
+	if err != nil {
+		repo.Close()
+		return nil, err
+	}
+	h := &branchHistory{repo: repo, preflight: preflight}
+
+	h.base, h.commits, err = repo.ListBranchCommits(ctx, upstream)
+	if err != nil {
+		h.Close(ctx)
+		return nil, err
+	}
+	if len(h.commits) == 0 {
+		h.Close(ctx)
+		return nil, fmt.Errorf("no commits since %s", upstream.Name)
+	}
+	return h, nil
+}
+
+func (h *branchHistory) Close(ctx context.Context) {
+	h.preflight.Restore(ctx)
+	h.repo.Close()
+}
+
+// pickAll returns the todo that picks each commit, unchanged
+func (h *branchHistory) pickAll() []git.RebaseTodoLine {
+	var todo []git.RebaseTodoLine
+	for _, commit := range h.commits {
+		todo = append(todo, git.RebaseTodoLine{Command: "pick", Arg: commit.SHA})
+	}
+	return todo
+}
+
+// rewrite runs an interactive rebase of the toc range, with the todo built by buildTodo.
+// buildTodo is passed the commits since upstream, oldest first, and the default todo that picks each of them.
+func rewrite(ctx context.Context, opt RewriteOptions, buildTodo func(commits []*git.Commit, todo []git.RebaseTodoLine) ([]git.RebaseTodoLine, error)) error {
+	h, err := openBranchHistory(ctx, opt)
+	if err != nil {
+		return err
+	}
+	defer h.Close(ctx)
+
+	todo, err := buildTodo(h.commits, h.pickAll())
+	if err != nil {
+		return err
+	}
+
+	return h.repo.RebaseWithTodo(ctx, h.base, todo)
+}
+
+// parseIndex parses a commit index, as printed by toc (starting at 1), returning the offset into commits.
+func parseIndex(s string, commits []*git.Commit) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid commit index %q (expected a number from toc)", s)
+	}
+	if n < 1 || n > len(commits) {
+		return 0, fmt.Errorf("commit index %d out of range (there are %d commits since upstream)", n, len(commits))
+	}
+	return n - 1, nil
+}
+
+// parseIndexRange parses a range of commit indexes, a..b (inclusive), or a single index.
+func parseIndexRange(s string, commits []*git.Commit) (int, int, error) {
+	from, to := s, s
+	if i := strings.Index(s, ".."); i != -1 {
+		from, to = s[:i], s[i+2:]
+	}
+	start, err := parseIndex(from, commits)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseIndex(to, commits)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid range %q: %s is before %s", s, to, from)
+	}
+	return start, end, nil
+}
+
+// amendMessage returns an exec todo line that replaces the message of the commit just picked.
+func amendMessage(messages []string) (git.RebaseTodoLine, error) {
+	args := []string{"git", "commit", "--amend", "--only", "--no-verify", "--quiet"}
+	for _, message := range messages {
+		if strings.Contains(message, "\n") {
+			return git.RebaseTodoLine{}, fmt.Errorf("message cannot contain a newline; use several -m flags for several paragraphs")
+		}
+		args = append(args, "-m", git.ShellQuote(message))
+	}
+	return git.RebaseTodoLine{Command: "exec", Arg: strings.Join(args, " ")}, nil
+}
@@ -0,0 +1,56 @@
+package history
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func addDropCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "drop <index>...",
+		Short: "removes commits from the current branch, by their index in toc",
+		Args:  cobra.MinimumNArgs(1),
+	}
+	var opt DropOptions
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		opt.Indexes = args
+		return RunDrop(cmd.Context(), opt)
+	}
+	addAutostashFlag(cmd, &opt.RewriteOptions)
+	parent.AddCommand(cmd)
+}
+
+type DropOptions struct {
+	RewriteOptions
+
+	// Indexes are the commits to drop, as numbered by toc
+	Indexes []string
+}
+
+func RunDrop(ctx context.Context, opt DropOptions) error {
+	return rewrite(ctx, opt.RewriteOptions, func(commits []*git.Commit, todo []git.RebaseTodoLine) ([]git.RebaseTodoLine, error) {
+		for _, arg := range opt.Indexes {
+			start, end, err := parseIndexRange(arg, commits)
+			if err != nil {
+				return nil, err
+			}
+			for i := start; i <= end; i++ {
+				todo[i].Command = "drop"
+			}
+		}
+		dropped := 0
+		for _, line := range todo {
+			if line.Command == "drop" {
+				dropped++
+			}
+		}
+		if dropped == len(todo) {
+			return nil, fmt.Errorf("refusing to drop every commit since upstream")
+		}
+		return todo, nil
+	})
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func addMoveCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "move <index> (--before <index> | --after <index>)",
+		Short: "reorders a commit on the current branch, by its index in toc",
+		Args:  cobra.ExactArgs(1),
+	}
+	var opt MoveOptions
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		opt.Index = args[0]
+		return RunMove(cmd.Context(), opt)
+	}
+	addAutostashFlag(cmd, &opt.RewriteOptions)
+	cmd.Flags().StringVar(&opt.Before, "before", opt.Before, "move the commit before the commit with this index")
+	cmd.Flags().StringVar(&opt.After, "after", opt.After, "move the commit after the commit with this index")
+	parent.AddCommand(cmd)
+}
+
+type MoveOptions struct {
+	RewriteOptions
+
+	// Index is the commit to move, as numbered by toc
+	Index string
+
+	// Before is the commit to move it in front of
+	Before string
+
+	// After is the commit to move it behind
+	After string
+}
+
+func RunMove(ctx context.Context, opt MoveOptions) error {
+	if (opt.Before == "") == (opt.After == "") {
+		return fmt.Errorf("must specify exactly one of --before or --after")
+	}
+
+	return rewrite(ctx, opt.RewriteOptions, func(commits []*git.Commit, todo []git.RebaseTodoLine) ([]git.RebaseTodoLine, error) {
+		from, err := parseIndex(opt.Index, commits)
+		if err != nil {
+			return nil, err
+		}
+
+		var to int
+		if opt.Before != "" {
+			to, err = parseIndex(opt.Before, commits)
+		} else {
+			to, err = parseIndex(opt.After, commits)
+			to++
+		}
+		if err != nil {
+			return nil, err
+		}
+		if to == from || to == from+1 {
+			return nil, fmt.Errorf("commit %s is already in that position", opt.Index)
+		}
+
+		line := todo[from]
+		var moved []git.RebaseTodoLine
+		for i := 0; i <= len(todo); i++ {
+			if i == to {
+				moved = append(moved, line)
+			}
+			if i < len(todo) && i != from {
+				moved = append(moved, todo[i])
+			}
+		}
+		return moved, nil
+	})
+}
@@ -0,0 +1,59 @@
+package history
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func addRewordCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "reword <index> -m <message>",
+		Short: "replaces the message of a commit on the current branch, by its index in toc",
+		Args:  cobra.ExactArgs(1),
+	}
+	var opt RewordOptions
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		opt.Index = args[0]
+		return RunReword(cmd.Context(), opt)
+	}
+	addAutostashFlag(cmd, &opt.RewriteOptions)
+	cmd.Flags().StringArrayVarP(&opt.Messages, "message", "m", opt.Messages, "the new message; if several are given they become separate paragraphs")
+	parent.AddCommand(cmd)
+}
+
+type RewordOptions struct {
+	RewriteOptions
+
+	// Index is the commit to reword, as numbered by toc
+	Index string
+
+	// Messages are the paragraphs of the new commit message
+	Messages []string
+}
+
+func RunReword(ctx context.Context, opt RewordOptions) error {
+	if len(opt.Messages) == 0 {
+		return fmt.Errorf("must specify the new message with -m")
+	}
+
+	return rewrite(ctx, opt.RewriteOptions, func(commits []*git.Commit, todo []git.RebaseTodoLine) ([]git.RebaseTodoLine, error) {
+		i, err := parseIndex(opt.Index, commits)
+		if err != nil {
+			return nil, err
+		}
+		amend, err := amendMessage(opt.Messages)
+		if err != nil {
+			return nil, err
+		}
+
+		var reworded []git.RebaseTodoLine
+		reworded = append(reworded, todo[:i+1]...)
+		reworded = append(reworded, amend)
+		reworded = append(reworded, todo[i+1:]...)
+		return reworded, nil
+	})
+}
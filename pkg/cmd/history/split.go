@@ -0,0 +1,308 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func addSplitCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "split <index> (--pattern <regex> | --path <glob>)... -m <message>...",
+		Short: "breaks a commit on the current branch into several commits, by its index in toc",
+		Long: `Breaks a commit (as numbered by toc) into several commits.
+
+Each --pattern or --path selects the hunks for one new commit, in the order given on the command line:
+--pattern selects the hunks whose lines match the regex (as with stage), and --path selects the hunks
+of the files (or directories) matching the glob.  A hunk selected by several goes to the first.
+
+Each new commit takes the next -m message.  Any hunks that are not selected (and any changes without
+hunks, such as binary files) form a final commit, using one extra -m message if given, otherwise the
+original message.  Authorship is kept from the original commit.`,
+		Args: cobra.ExactArgs(1),
+	}
+	var opt SplitOptions
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		opt.Index = args[0]
+		return RunSplit(cmd.Context(), opt)
+	}
+	addAutostashFlag(cmd, &opt.RewriteOptions)
+	cmd.Flags().BoolVar(&opt.DryRun, "dry-run", opt.DryRun, "preview only, don't make changes")
+	cmd.Flags().Var(&partsValue{kind: "pattern", parts: &opt.Parts}, "pattern", "regex selecting the hunks for the next new commit")
+	cmd.Flags().Var(&partsValue{kind: "path", parts: &opt.Parts}, "path", "glob selecting the files for the next new commit")
+	cmd.Flags().StringArrayVarP(&opt.Messages, "message", "m", opt.Messages, "the message for the next new commit")
+	parent.AddCommand(cmd)
+}
+
+type SplitOptions struct {
+	RewriteOptions
+
+	DryRun bool
+
+	// Index is the commit to split, as numbered by toc
+	Index string
+
+	// Parts select the hunks for each new commit, in order
+	Parts []SplitPart
+
+	// Messages are the messages for each new commit, plus optionally one for the remaining hunks
+	Messages []string
+}
+
+// SplitPart selects the hunks for one of the new commits, either by Pattern or by Path
+type SplitPart struct {
+	// Pattern is a regex matched against the lines of each hunk
+	Pattern string
+
+	// Path is a glob matched against the path of each hunk, or its directories
+	Path string
+}
+
+func (p *SplitPart) String() string {
+	if p.Pattern != "" {
+		return "--pattern " + p.Pattern
+	}
+	return "--path " + p.Path
+}
+
+// partsValue is a flag that appends to the parts, so that --pattern and --path keep their relative order
+type partsValue struct {
+	kind  string
+	parts *[]SplitPart
+}
+
+func (v *partsValue) String() string {
+	return ""
+}
+
+func (v *partsValue) Set(s string) error {
+	if s == "" {
+		return fmt.Errorf("%s cannot be empty", v.kind)
+	}
+	part := SplitPart{}
+	if v.kind == "pattern" {
+		part.Pattern = s
+	} else {
+		part.Path = s
+	}
+	*v.parts = append(*v.parts, part)
+	return nil
+}
+
+func (v *partsValue) Type() string {
+	if v.kind == "pattern" {
+		return "regex"
+	}
+	return "glob"
+}
+
+func RunSplit(ctx context.Context, opt SplitOptions) error {
+	if len(opt.Parts) == 0 {
+		return fmt.Errorf("must specify the hunks for the new commits with --pattern or --path")
+	}
+	if len(opt.Messages) != len(opt.Parts) && len(opt.Messages) != len(opt.Parts)+1 {
+		return fmt.Errorf("must specify a -m message for each --pattern or --path (and optionally one more for the remaining hunks)")
+	}
+
+	h, err := openBranchHistory(ctx, opt.RewriteOptions)
+	if err != nil {
+		return err
+	}
+	defer h.Close(ctx)
+	repo := h.repo
+
+	i, err := parseIndex(opt.Index, h.commits)
+	if err != nil {
+		return err
+	}
+	commit := h.commits[i]
+
+	parents, err := repo.CommitParents(ctx, commit.SHA)
+	if err != nil {
+		return err
+	}
+	if len(parents) != 1 {
+		return fmt.Errorf("cannot split merge commit %s", commit.ShortSHA())
+	}
+
+	diff, err := repo.ExecGit(ctx, "diff", "-U0", "--no-color", "--no-ext-diff", "--no-renames", parents[0], commit.SHA)
+	if err != nil {
+		return err
+	}
+	hunks, err := git.ParseDiff(strings.NewReader(diff.Stdout))
+	if err != nil {
+		return err
+	}
+
+	// Assign each hunk to the first part that selects it; the rest form the final commit
+	groups, remaining, err := assignHunks(hunks, opt.Parts)
+	if err != nil {
+		return err
+	}
+	if len(remaining) == 0 && len(opt.Messages) > len(opt.Parts) {
+		return fmt.Errorf("every hunk was selected, so there is no final commit for the last -m message")
+	}
+	if len(remaining) == 0 && len(groups) == 1 {
+		return fmt.Errorf("every hunk was selected by %s, so there is nothing to split", &opt.Parts[0])
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "HUNK\tCOMMIT\n")
+	for j, group := range groups {
+		for _, hunk := range group {
+			fmt.Fprintf(w, "%s\t%d: %s\n", hunk.Location(), j+1, firstLine(opt.Messages[j]))
+		}
+	}
+	remainingMessage := commit.Subject
+	if len(opt.Messages) > len(opt.Parts) {
+		remainingMessage = firstLine(opt.Messages[len(opt.Parts)])
+	}
+	for _, hunk := range remaining {
+		fmt.Fprintf(w, "%s\t%d: %s\n", hunk.Location(), len(groups)+1, remainingMessage)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if opt.DryRun {
+		return nil
+	}
+
+	todo := h.pickAll()
+	todo[i].Command = "edit"
+	if err := repo.RebaseWithTodo(ctx, h.base, todo); err != nil {
+		return err
+	}
+
+	if err := splitStoppedCommit(ctx, repo, commit, hunks, groups, remaining, opt.Messages); err != nil {
+		if _, abortErr := repo.ExecGit(ctx, "rebase", "--abort"); abortErr != nil {
+			klog.Warningf("error aborting rebase: %v", abortErr)
+		}
+		return err
+	}
+
+	return repo.ContinueRebase(ctx)
+}
+
+// assignHunks returns the hunks selected by each part, and the hunks that no part selected.
+func assignHunks(hunks []*git.Hunk, parts []SplitPart) ([][]*git.Hunk, []*git.Hunk, error) {
+	assigned := make(map[*git.Hunk]bool)
+	var groups [][]*git.Hunk
+	for j := range parts {
+		part := &parts[j]
+
+		var selected []*git.Hunk
+		if part.Pattern != "" {
+			re, err := regexp.Compile(part.Pattern)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid regex pattern %q: %w", part.Pattern, err)
+			}
+			selected = git.SelectHunksByPattern(hunks, re)
+		} else {
+			matched, err := git.SelectHunksByPath(hunks, part.Path)
+			if err != nil {
+				return nil, nil, err
+			}
+			selected = matched
+		}
+
+		var group []*git.Hunk
+		for _, hunk := range selected {
+			if !assigned[hunk] {
+				assigned[hunk] = true
+				group = append(group, hunk)
+			}
+		}
+		if len(group) == 0 {
+			return nil, nil, fmt.Errorf("no hunks matched %s", part)
+		}
+		groups = append(groups, group)
+	}
+
+	var remaining []*git.Hunk
+	for _, hunk := range hunks {
+		if !assigned[hunk] {
+			remaining = append(remaining, hunk)
+		}
+	}
+	return groups, remaining, nil
+}
+
+// splitStoppedCommit replaces the commit the rebase stopped at with one commit per group, plus one for the remaining hunks.
+// The final commit always has the tree of the original commit, so it also picks up any changes without hunks.
+func splitStoppedCommit(ctx context.Context, repo *git.Repo, commit *git.Commit, hunks []*git.Hunk, groups [][]*git.Hunk, remaining []*git.Hunk, messages []string) error {
+	author, err := repo.ExecGit(ctx, "log", "-1", "--format=%an <%ae>%x00%ad", "--date=raw", commit.SHA)
+	if err != nil {
+		return err
+	}
+	tokens := strings.SplitN(strings.TrimSpace(author.Stdout), "\x00", 2)
+	if len(tokens) != 2 {
+		return fmt.Errorf("unexpected author output %q", author.Stdout)
+	}
+	authorArgs := []string{"--author=" + tokens[0], "--date=" + tokens[1]}
+
+	// Keep the working tree as the original commit, but move HEAD and the index back to its parent
+	if _, err := repo.ExecGit(ctx, "reset", "--quiet", "HEAD^"); err != nil {
+		return err
+	}
+
+	applier := repo.NewHunkApplier(hunks)
+	for j, group := range groups {
+		last := j == len(groups)-1 && len(remaining) == 0
+		if last {
+			if _, err := repo.ExecGit(ctx, "read-tree", commit.SHA); err != nil {
+				return err
+			}
+		} else if err := applier.ApplyToIndex(ctx, group); err != nil {
+			return err
+		}
+
+		args := []string{"commit", "--quiet", "--no-verify"}
+		args = append(args, authorArgs...)
+		args = append(args, "-m", messages[j])
+		if result, err := repo.ExecGit(ctx, args...); err != nil {
+			if result.ExitCode != 0 {
+				result.PrintOutput()
+			}
+			return fmt.Errorf("error creating commit %d: %w", j+1, err)
+		}
+	}
+
+	if len(remaining) != 0 {
+		if _, err := repo.ExecGit(ctx, "read-tree", commit.SHA); err != nil {
+			return err
+		}
+		args := []string{"commit", "--quiet", "--no-verify"}
+		if len(messages) > len(groups) {
+			args = append(args, authorArgs...)
+			args = append(args, "-m", messages[len(groups)])
+		} else {
+			// Keep the original message (and authorship)
+			args = append(args, "--reuse-message="+commit.SHA)
+		}
+		if result, err := repo.ExecGit(ctx, args...); err != nil {
+			if result.ExitCode != 0 {
+				result.PrintOutput()
+			}
+			return fmt.Errorf("error creating final commit: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// firstLine returns the first line of a commit message, for reporting.
+func firstLine(message string) string {
+	if i := strings.Index(message, "\n"); i != -1 {
+		return message[:i]
+	}
+	return message
+}
@@ -0,0 +1,73 @@
+package history
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func addSquashCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "squash <index>..<index>",
+		Short: "combines a range of commits on the current branch into one, by their indexes in toc",
+		Long: `Combines a range of commits (inclusive, as numbered by toc) into a single commit.
+
+The combined commit keeps the messages of all the commits, unless a new message is given with -m.`,
+		Args: cobra.ExactArgs(1),
+	}
+	var opt SquashOptions
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		opt.Range = args[0]
+		return RunSquash(cmd.Context(), opt)
+	}
+	addAutostashFlag(cmd, &opt.RewriteOptions)
+	cmd.Flags().StringArrayVarP(&opt.Messages, "message", "m", opt.Messages, "the message for the combined commit; if several are given they become separate paragraphs")
+	parent.AddCommand(cmd)
+}
+
+type SquashOptions struct {
+	RewriteOptions
+
+	// Range is the commits to combine, a..b as numbered by toc
+	Range string
+
+	// Messages, if set, are the paragraphs of the message for the combined commit
+	Messages []string
+}
+
+func RunSquash(ctx context.Context, opt SquashOptions) error {
+	return rewrite(ctx, opt.RewriteOptions, func(commits []*git.Commit, todo []git.RebaseTodoLine) ([]git.RebaseTodoLine, error) {
+		start, end, err := parseIndexRange(opt.Range, commits)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("must specify at least two commits to squash")
+		}
+
+		// With a new message, the messages of the squashed commits are discarded
+		command := "squash"
+		if len(opt.Messages) != 0 {
+			command = "fixup"
+		}
+		for i := start + 1; i <= end; i++ {
+			todo[i].Command = command
+		}
+
+		if len(opt.Messages) == 0 {
+			return todo, nil
+		}
+		amend, err := amendMessage(opt.Messages)
+		if err != nil {
+			return nil, err
+		}
+		var squashed []git.RebaseTodoLine
+		squashed = append(squashed, todo[:end+1]...)
+		squashed = append(squashed, amend)
+		squashed = append(squashed, todo[end+1:]...)
+		return squashed, nil
+	})
+}
@@ -19,13 +19,23 @@ func AddCommand(ctx context.Context, parent *cobra.Command) {
 	var opt Options
 	opt.InitDefaults()
 
+	var autostash bool
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("autostash") {
+			opt.Autostash = &autostash
+		}
 		return Run(cmd.Context(), opt, args[0], args[1:])
 	}
+	cmd.Flags().BoolVar(&autostash, "autostash", autostash, "stash uncommitted changes and restore them afterwards (default from gitflow.autostash)")
+
+	addUpdateCommand(ctx, cmd)
+
 	parent.AddCommand(cmd)
 }
 
 type Options struct {
+	// Autostash, if set, overrides the gitflow.autostash setting
+	Autostash *bool
 }
 
 func (o *Options) InitDefaults() {
@@ -49,6 +59,12 @@ func Run(ctx context.Context, opt Options, prBranchName string, shas []string) e
 		return err
 	}
 
+	preflight, err := repo.Preflight(ctx, git.PreflightOptions{Autostash: opt.Autostash})
+	if err != nil {
+		return err
+	}
+	defer preflight.Restore(ctx)
+
 	originalBranch, err := repo.CurrentBranch(ctx)
 	if err != nil {
 		return err
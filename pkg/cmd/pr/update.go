@@ -0,0 +1,204 @@
+package pr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func addUpdateCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "update <branch> [sha...]",
+		Short: "Push new commits to an existing pull request branch",
+		Long: `Update the branch for an existing pull request.
+
+If commits are specified, the branch is rebuilt from the freshly fetched upstream
+with those commits cherry-picked on top.  Otherwise the branch is rebased onto
+the freshly fetched upstream.
+
+The branch is then pushed to your fork with --force-with-lease against the last
+pushed commit, and a summary comment is posted on the pull request.`,
+		Args: cobra.MinimumNArgs(1),
+		Example: `  # Rebase the my-fix branch onto upstream and push it
+  gitflow pr update my-fix
+
+  # Rebuild the my-fix branch from two commits
+  gitflow pr update my-fix abc123 def456`,
+	}
+	var opt UpdateOptions
+	opt.InitDefaults()
+
+	var autostash bool
+	cmd.Flags().BoolVar(&opt.Comment, "comment", opt.Comment, "post a comment on the pull request summarizing the update")
+	cmd.Flags().BoolVar(&autostash, "autostash", autostash, "stash uncommitted changes and restore them afterwards (default from gitflow.autostash)")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("autostash") {
+			opt.Autostash = &autostash
+		}
+		return RunUpdate(cmd.Context(), opt, args[0], args[1:])
+	}
+	parent.AddCommand(cmd)
+}
+
+type UpdateOptions struct {
+	// Comment controls whether we post a summary comment on the pull request
+	Comment bool
+
+	// Autostash, if set, overrides the gitflow.autostash setting
+	Autostash *bool
+}
+
+func (o *UpdateOptions) InitDefaults() {
+	o.Comment = true
+}
+
+func RunUpdate(ctx context.Context, opt UpdateOptions, prBranchName string, shas []string) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	forkRemote, err := repo.FindForkRemoteForPullRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	upstream, err := repo.FindUpstreamBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	preflight, err := repo.Preflight(ctx, git.PreflightOptions{Autostash: opt.Autostash})
+	if err != nil {
+		return err
+	}
+	defer preflight.Restore(ctx)
+
+	originalBranch, err := repo.CurrentBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := upstream.Remote.Fetch(ctx); err != nil {
+		return err
+	}
+
+	if err := forkRemote.FetchBranch(ctx, prBranchName); err != nil {
+		return err
+	}
+
+	pushedBranch := &git.Branch{Name: forkRemote.Name + "/" + prBranchName, ShortName: prBranchName, Remote: forkRemote}
+	lastPushed, err := repo.RevParse(ctx, pushedBranch.Name)
+	if err != nil {
+		return fmt.Errorf("cannot find pushed branch %q: %w", pushedBranch.Name, err)
+	}
+
+	if len(shas) != 0 {
+		// Rebuild the branch from upstream with the new commits
+		if _, err := repo.CheckoutResetBranch(ctx, prBranchName, upstream); err != nil {
+			return err
+		}
+		if err := repo.CherryPick(ctx, shas); err != nil {
+			return err
+		}
+	} else {
+		if _, err := repo.RevParse(ctx, "refs/heads/"+prBranchName); err != nil {
+			// No local branch; start from what we last pushed
+			if _, err := repo.CheckoutNewBranch(ctx, prBranchName, pushedBranch); err != nil {
+				return err
+			}
+		} else {
+			// Don't overwrite commits that others pushed to the branch (e.g. maintainer edits or applied suggestions)
+			if _, err := repo.ExecGit(ctx, "merge-base", "--is-ancestor", lastPushed, "refs/heads/"+prBranchName); err != nil {
+				return fmt.Errorf("local branch %q does not contain %s (the tip of %s); merge or rebase onto %s first, or delete the local branch to start from it",
+					prBranchName, lastPushed[:12], pushedBranch.Name, pushedBranch.Name)
+			}
+			if err := repo.Checkout(ctx, &git.Branch{Name: prBranchName, ShortName: prBranchName}); err != nil {
+				return err
+			}
+		}
+		if _, err := repo.ExecGitInteractive(ctx, "rebase", upstream.Name); err != nil {
+			return err
+		}
+	}
+
+	newHead, err := repo.RevParse(ctx, "HEAD")
+	if err != nil {
+		return err
+	}
+
+	if newHead == lastPushed {
+		fmt.Printf("branch %q is already up to date\n", prBranchName)
+	} else {
+		if err := repo.Push(ctx, forkRemote, git.PushOptions{
+			ForceWithLease: prBranchName + ":" + lastPushed,
+			Refspecs:       []string{prBranchName},
+		}); err != nil {
+			return err
+		}
+
+		summary, err := buildUpdateSummary(ctx, repo, upstream, lastPushed, newHead)
+		if err != nil {
+			return err
+		}
+		fmt.Print(summary)
+
+		if opt.Comment {
+			forkInfo, err := forkRemote.GithubInfo(ctx)
+			if err != nil {
+				return err
+			}
+			prs, err := upstream.Remote.ListPullRequestsForBranch(ctx, forkInfo.Organization, prBranchName, "open")
+			if err != nil {
+				return err
+			}
+			if len(prs) == 0 {
+				klog.Warningf("no open pull request found for %s:%s; not commenting", forkInfo.Organization, prBranchName)
+			}
+			for _, pr := range prs {
+				if err := upstream.Remote.CommentOnPullRequest(ctx, pr.Number(), summary); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := repo.Checkout(ctx, originalBranch); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func buildUpdateSummary(ctx context.Context, repo *git.Repo, upstream *git.Branch, oldHead, newHead string) (string, error) {
+	upstreamHead, err := repo.RevParse(ctx, upstream.Name)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := repo.ExecGit(ctx, "log", "--oneline", "--reverse", upstream.Name+".."+newHead)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(fmt.Sprintf("Updated from %s to %s, based on %s (%s)\n", shortSHA(oldHead), shortSHA(newHead), upstream.ShortName, shortSHA(upstreamHead)))
+	b.WriteString("\n")
+	b.WriteString("```\n")
+	b.WriteString(result.Stdout)
+	b.WriteString("```\n")
+	return b.String(), nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"k8s.io/klog"
@@ -14,20 +17,75 @@ import (
 
 func AddCommand(ctx context.Context, parent *cobra.Command) {
 	cmd := &cobra.Command{
-		Use: "prune",
+		Use:   "prune",
+		Short: "deletes local branches that have been merged into a release branch",
+		Long: `Deletes local branches that have been merged into any upstream release branch,
+including branches that were squash-merged or rebase-merged, and branches whose recorded pull request was merged.
+Branches whose tracked remote branch has been deleted ([gone]) are deleted too.
+Branches checked out in any worktree are never deleted.
+
+Stale worktrees (whose directories have been removed) and remote-tracking refs for
+branches deleted on the upstream or fork remotes are cleaned up as well.
+
+Release branches are main, master and release-* unless configured with gitflow.release.pattern;
+this can be set multiple times, and each value is a glob (release/*) or a regular expression in slashes (/^lts-[0-9]+$/).
+Branches matching gitflow.protected (same syntax, also multi-valued) are never deleted, nor are release branches.
+
+With --older-than, unmerged branches with no recent commits are deleted too.
+With --interactive, the candidates are listed in your editor, where you choose which to delete.
+
+Before a branch is deleted, its tip is saved as refs/gitflow/pruned/<branch>;
+restore it with: git branch <branch> refs/gitflow/pruned/<branch>`,
 	}
 	var opt Options
+	var olderThan string
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if olderThan != "" {
+			d, err := parseAge(olderThan)
+			if err != nil {
+				return err
+			}
+			opt.OlderThan = d
+		}
 		return Run(cmd.Context(), opt)
 	}
 	cmd.Flags().BoolVar(&opt.DryRun, "dry-run", opt.DryRun, "preview only, don't make changes")
+	cmd.Flags().BoolVarP(&opt.Interactive, "interactive", "i", opt.Interactive, "choose which branches to delete in your editor")
+	cmd.Flags().StringVar(&olderThan, "older-than", olderThan, "also delete unmerged branches with no commits in this long (e.g. 90d, 12w, 720h)")
+	cmd.Flags().BoolVar(&opt.Fork, "fork", opt.Fork, "also delete the pruned branches on the fork remote, once their pull requests are merged or closed")
 	parent.AddCommand(cmd)
 }
 
 type Options struct {
 	DryRun bool
+
+	// Fork controls whether we also delete the corresponding branches on the fork remote
+	Fork bool
+
+	// Interactive lets the user choose which of the candidate branches to delete
+	Interactive bool
+
+	// OlderThan, if set, also selects unmerged branches whose last commit is older than this
+	OlderThan time.Duration
+}
+
+// candidate is a local branch that qualifies for pruning
+type candidate struct {
+	Branch string
+
+	// Reason describes why the branch qualifies, e.g. "squash-merged into main"
+	Reason string
+
+	// LastCommit is the time of the last commit on the branch
+	LastCommit time.Time
+
+	// PullRequestURL is the url of the pull request recorded for the branch, if any
+	PullRequestURL string
 }
 
+// backupRefPrefix is where we save the tips of deleted branches, so they can be recovered
+const backupRefPrefix = "refs/gitflow/pruned/"
+
 func Run(ctx context.Context, opt Options) error {
 	repo, err := git.OpenRepo(ctx)
 	if err != nil {
@@ -44,29 +102,71 @@ func Run(ctx context.Context, opt Options) error {
 		return err
 	}
 
+	// Clean up after deleted worktrees and remote branches first, as that makes more branches eligible
+	if err := pruneWorktrees(ctx, repo, opt.DryRun); err != nil {
+		return err
+	}
+	remotes := []*git.Remote{upstreamRemote}
+	if forkRemote, err := repo.FindForkRemoteForPullRequests(ctx); err != nil {
+		klog.Warningf("not pruning fork remote-tracking refs: %v", err)
+	} else if forkRemote.Name != upstreamRemote.Name {
+		remotes = append(remotes, forkRemote)
+	}
+	prunedRefs, err := pruneRemoteTrackingRefs(ctx, repo, remotes, opt.DryRun)
+	if err != nil {
+		return err
+	}
+	goneBranches, err := findGoneBranches(ctx, repo, prunedRefs)
+	if err != nil {
+		return err
+	}
+
+	// We never delete a branch that is checked out, including in another worktree
+	checkedOut, err := checkedOutBranches(ctx, repo)
+	if err != nil {
+		return err
+	}
+
 	allBranches, err := upstreamRemote.ListBranches(ctx)
 	if err != nil {
 		return err
 	}
 
+	releasePatterns, err := repo.ReleaseBranchPatterns(ctx)
+	if err != nil {
+		return err
+	}
+	protectedPatterns, err := repo.ProtectedBranchPatterns(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("release branch patterns (gitflow.release.pattern): %v\n", releasePatterns)
+	fmt.Printf("protected branch patterns (gitflow.protected): %v\n", protectedPatterns)
+
+	releaseBranchList := releasePatterns.Filter(allBranches)
 	releaseBranches := make(map[string]*git.Branch)
-	for _, branch := range allBranches {
-		if branch.ShortName == "main" || branch.ShortName == "master" {
-			releaseBranches[branch.ShortName] = branch
-		} else if strings.HasPrefix(branch.ShortName, "release-") {
-			releaseBranches[branch.ShortName] = branch
-		}
+	for _, branch := range releaseBranchList {
+		releaseBranches[branch.ShortName] = branch
 	}
 
 	if len(releaseBranches) == 0 {
-		return fmt.Errorf("cannot determine any release branches")
+		return fmt.Errorf("cannot determine any release branches matching %v", releasePatterns)
 	}
 
-	fmt.Printf("checking for branches merged into any of %v\n", mapValues(releaseBranches))
+	// isProtected returns true for branches we must never delete
+	isProtected := func(branchName string) bool {
+		if _, found := releaseBranches[branchName]; found {
+			return true
+		}
+		return releasePatterns.Match(branchName) || protectedPatterns.Match(branchName)
+	}
 
-	pruneBranches := make(map[string]bool)
+	fmt.Printf("checking for branches merged into any of %v\n", releaseBranchList)
 
-	for _, releaseBranch := range releaseBranches {
+	// pruneBranches maps each branch we will delete to the reason it qualifies
+	pruneBranches := make(map[string]string)
+
+	for _, releaseBranch := range releaseBranchList {
 		args := []string{"branch", "--merged", releaseBranch.Name}
 		result, err := repo.ExecGit(ctx, args...)
 		if err != nil {
@@ -79,7 +179,7 @@ func Run(ctx context.Context, opt Options) error {
 			if len(tokens) == 0 {
 				// Ignore empty lines
 			} else if len(tokens) == 2 && tokens[0] == "+" {
-				// Checked out as worktree somewhere
+				// Checked out as worktree somewhere (possibly a stale one)
 				branchName = tokens[1]
 			} else if len(tokens) == 2 && tokens[0] == "*" {
 				// Current branch
@@ -91,41 +191,333 @@ func Run(ctx context.Context, opt Options) error {
 			}
 
 			if branchName != "" {
-				if _, found := releaseBranches[branchName]; found {
-					klog.Infof("won't delete release branch %q", branchName)
-				} else {
-					pruneBranches[branchName] = true
+				if isProtected(branchName) {
+					klog.Infof("won't delete protected branch %q", branchName)
+				} else if checkedOut[branchName] {
+					klog.Infof("won't delete branch %q, which is checked out in a worktree", branchName)
+				} else if _, found := pruneBranches[branchName]; !found {
+					pruneBranches[branchName] = "merged into " + releaseBranch.ShortName
 					klog.Infof("branch %q is merged into %q", branchName, releaseBranch.Name)
 				}
 			}
 		}
 	}
 
+	// Squash and rebase merges don't show up in git branch --merged, so we look for equivalent changes,
+	// and for pull requests we have recorded against the branch.
+	localBranches, err := repo.ListLocalBranches(ctx)
+	if err != nil {
+		return err
+	}
+	for _, branch := range localBranches {
+		if _, found := pruneBranches[branch.ShortName]; found {
+			continue
+		}
+		if isProtected(branch.ShortName) {
+			continue
+		}
+		if checkedOut[branch.ShortName] {
+			continue
+		}
+
+		reason, err := findLandedReason(ctx, repo, upstreamRemote, releaseBranchList, branch)
+		if err != nil {
+			klog.Warningf("error checking whether branch %q was merged: %v", branch.ShortName, err)
+			continue
+		}
+		if reason != "" {
+			pruneBranches[branch.ShortName] = reason
+			klog.Infof("branch %q is %s", branch.ShortName, reason)
+			continue
+		}
+
+		if gone, found := goneBranches[branch.ShortName]; found {
+			if gone.Unpushed != 0 {
+				fmt.Printf("not deleting %s (tracked branch %s is gone, has %d unpushed commit(s))\n", branch.ShortName, gone.Upstream, gone.Unpushed)
+				continue
+			}
+			pruneBranches[branch.ShortName] = "tracked branch " + gone.Upstream + " is gone"
+			klog.Infof("branch %q tracks %q, which is gone", branch.ShortName, gone.Upstream)
+			continue
+		}
+
+		if opt.OlderThan != 0 {
+			lastCommit, err := repo.CommitTime(ctx, branch.Name)
+			if err != nil {
+				return err
+			}
+			if age := time.Since(lastCommit); age > opt.OlderThan {
+				pruneBranches[branch.ShortName] = fmt.Sprintf("unmerged, no commits for %s", formatAge(age))
+				klog.Infof("branch %q has no commits since %v", branch.ShortName, lastCommit)
+			}
+		}
+	}
+
+	// We only need the upstream repository for pull request links
+	upstreamInfo, err := upstreamRemote.GithubInfo(ctx)
+	if err != nil {
+		klog.Warningf("cannot link pull requests: %v", err)
+	}
+
+	var candidates []*candidate
+	for branchName, reason := range pruneBranches {
+		c := &candidate{Branch: branchName, Reason: reason}
+		c.LastCommit, err = repo.CommitTime(ctx, "refs/heads/"+branchName)
+		if err != nil {
+			return err
+		}
+		prNumber, err := repo.GetBranchPullRequest(ctx, branchName)
+		if err != nil {
+			return err
+		}
+		if prNumber != "" && upstreamInfo != nil {
+			c.PullRequestURL = upstreamInfo.PullRequestURL(prNumber)
+		}
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Branch < candidates[j].Branch })
+
+	if opt.Interactive && len(candidates) != 0 {
+		candidates, err = editPlan(ctx, repo, candidates)
+		if err != nil {
+			return err
+		}
+	}
+
+	var branchNames []string
+	for _, c := range candidates {
+		branchNames = append(branchNames, c.Branch)
+		if opt.DryRun {
+			fmt.Printf("would delete %s (%s)\n", c.Branch, c.Reason)
+		} else {
+			fmt.Printf("deleting %s (%s)\n", c.Branch, c.Reason)
+		}
+	}
+
+	// Read the stacks first, as deleting a branch also deletes its recorded parent
+	parents, err := repo.ListBranchParents(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	deleted := make(map[string]bool)
 	if !opt.DryRun {
-		var errs []error
-		for pruneBranch := range pruneBranches {
-			if err := repo.DeleteBranch(ctx, pruneBranch); err != nil {
+		for _, c := range candidates {
+			// Save the tip first, so the branch can be recovered
+			backupRef := backupRefPrefix + c.Branch
+			if err := repo.UpdateRef(ctx, backupRef, "refs/heads/"+c.Branch, "gitflow prune: "+c.Reason); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := repo.DeleteBranch(ctx, c.Branch); err != nil {
 				errs = append(errs, err)
+				continue
 			}
+			deleted[c.Branch] = true
+		}
+		if len(candidates) != 0 {
+			fmt.Printf("deleted branches are saved under %s; restore with: git branch <name> %s<name>\n", backupRefPrefix, backupRefPrefix)
+			fmt.Printf("earlier branches with the same name are in: git reflog %s<name>\n", backupRefPrefix)
+		}
+	} else {
+		for _, c := range candidates {
+			deleted[c.Branch] = true
+		}
+	}
+
+	if err := reparentChildren(ctx, repo, parents, deleted, opt.DryRun); err != nil {
+		errs = append(errs, err)
+	}
+
+	if opt.Fork {
+		if err := pruneForkBranches(ctx, repo, upstreamRemote, branchNames, opt.DryRun); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reparentChildren restacks the branches that were stacked on a deleted branch onto the deleted branch's own parent,
+// or unstacks them (so they are rebased onto upstream) if it had none.
+func reparentChildren(ctx context.Context, repo *git.Repo, parents map[string]string, deleted map[string]bool, dryRun bool) error {
+	var children []string
+	for child, parent := range parents {
+		if deleted[parent] && !deleted[child] {
+			children = append(children, child)
 		}
-		return errors.Join(errs...)
 	}
+	sort.Strings(children)
+
+	for _, child := range children {
+		// Skip over parents that were also deleted
+		newParent := parents[child]
+		seen := make(map[string]bool)
+		for deleted[newParent] && !seen[newParent] {
+			seen[newParent] = true
+			newParent = parents[newParent]
+		}
+		if deleted[newParent] {
+			newParent = ""
+		}
 
+		verb := "restacking"
+		if dryRun {
+			verb = "would restack"
+		}
+		if newParent == "" {
+			fmt.Printf("%s %s onto upstream (was stacked on %s)\n", verb, child, parents[child])
+		} else {
+			fmt.Printf("%s %s onto %s (was stacked on %s)\n", verb, child, newParent, parents[child])
+		}
+		if dryRun {
+			continue
+		}
+		if err := repo.SetBranchParent(ctx, child, newParent); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func mapKeys[K comparable, V any](m map[K]V) []K {
-	var keys []K
-	for k := range m {
-		keys = append(keys, k)
+// pruneForkBranches deletes the branches on our fork that correspond to the pruned local branches.
+// We only delete a fork branch when it has a pull request, and all its pull requests are merged or closed.
+func pruneForkBranches(ctx context.Context, repo *git.Repo, upstreamRemote *git.Remote, branchNames []string, dryRun bool) error {
+	forkRemote, err := repo.FindForkRemoteForPullRequests(ctx)
+	if err != nil {
+		return err
+	}
+	if forkRemote.Name == upstreamRemote.Name {
+		klog.Warningf("fork remote is the upstream remote %q; won't delete branches there", upstreamRemote.Name)
+		return nil
+	}
+
+	forkInfo, err := forkRemote.GithubInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, branchName := range branchNames {
+		if _, err := repo.RevParse(ctx, "refs/remotes/"+forkRemote.Name+"/"+branchName); err != nil {
+			klog.V(2).Infof("branch %q not found on fork remote %q", branchName, forkRemote.Name)
+			continue
+		}
+
+		prs, err := upstreamRemote.ListPullRequestsForBranch(ctx, forkInfo.Organization, branchName, "all")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(prs) == 0 {
+			klog.Infof("not deleting %s/%s: no pull request found", forkRemote.Name, branchName)
+			continue
+		}
+		open := false
+		for _, pr := range prs {
+			if pr.State() == "open" {
+				klog.Infof("not deleting %s/%s: pull request #%d is open", forkRemote.Name, branchName, pr.Number())
+				open = true
+			}
+		}
+		if open {
+			continue
+		}
+
+		if dryRun {
+			fmt.Printf("would delete %s/%s (pull request #%d is %s)\n", forkRemote.Name, branchName, prs[0].Number(), prState(prs[0]))
+			continue
+		}
+		fmt.Printf("deleting %s/%s (pull request #%d is %s)\n", forkRemote.Name, branchName, prs[0].Number(), prState(prs[0]))
+		if err := forkRemote.DeleteBranch(ctx, branchName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func prState(pr *git.GithubPullRequest) string {
+	if pr.Merged() {
+		return "merged"
+	}
+	return pr.State()
+}
+
+// findLandedReason checks whether the changes on the branch have landed on any of the release branches,
+// by squash or rebase merge, or because the pull request recorded for the branch was merged.
+// It returns a description of how the branch landed, or "" if it has not.
+func findLandedReason(ctx context.Context, repo *git.Repo, upstreamRemote *git.Remote, releaseBranches []*git.Branch, branch *git.Branch) (string, error) {
+	for _, releaseBranch := range releaseBranches {
+		rebased, err := repo.IsRebaseMerged(ctx, releaseBranch.Name, branch.Name)
+		if err != nil {
+			return "", err
+		}
+		if rebased {
+			return "rebase-merged into " + releaseBranch.ShortName, nil
+		}
+
+		squashed, err := repo.IsSquashMerged(ctx, releaseBranch.Name, branch.Name)
+		if err != nil {
+			return "", err
+		}
+		if squashed {
+			return "squash-merged into " + releaseBranch.ShortName, nil
+		}
+	}
+
+	prNumber, err := repo.GetBranchPullRequest(ctx, branch.ShortName)
+	if err != nil {
+		return "", err
+	}
+	if prNumber == "" {
+		return "", nil
+	}
+	pr, err := upstreamRemote.GetPullRequest(ctx, prNumber)
+	if err != nil {
+		return "", err
+	}
+	if !pr.Merged() {
+		return "", nil
+	}
+
+	// Don't lose work that was committed after the pull request was merged
+	tip, err := repo.RevParse(ctx, branch.Name)
+	if err != nil {
+		return "", err
+	}
+	if tip != pr.HeadSHA() {
+		if _, err := repo.ExecGit(ctx, "merge-base", "--is-ancestor", tip, pr.HeadSHA()); err != nil {
+			klog.Infof("branch %q has commits that are not in merged pull request #%s", branch.ShortName, prNumber)
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("pull request #%s merged into %s", prNumber, pr.BaseBranch()), nil
+}
+
+// parseAge parses a duration, additionally accepting days (90d) and weeks (12w).
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			count, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil {
+				return 0, fmt.Errorf("cannot parse age %q: %w", s, err)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse age %q (expected e.g. 90d, 12w or 720h): %w", s, err)
 	}
-	return keys
+	return d, nil
 }
 
-func mapValues[K comparable, V any](m map[K]V) []V {
-	var values []V
-	for _, v := range m {
-		values = append(values, v)
+// formatAge formats a duration in days, for display.
+func formatAge(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	if days == 1 {
+		return "1 day"
 	}
-	return values
+	return fmt.Sprintf("%d days", days)
 }
@@ -0,0 +1,82 @@
+package prune
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// editPlan writes the candidates to a file, lets the user choose which to delete, and parses the result.
+func editPlan(ctx context.Context, repo *git.Repo, candidates []*candidate) ([]*candidate, error) {
+	gitDir, err := repo.GitDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := filepath.Join(gitDir, "GITFLOW_PRUNE_PLAN")
+
+	var b bytes.Buffer
+	b.WriteString("# Branches on \"delete\" lines will be deleted.\n")
+	b.WriteString("# Change \"delete\" to \"keep\" (or remove the line) to keep a branch.\n")
+	b.WriteString("#\n")
+	for _, c := range candidates {
+		line := fmt.Sprintf("delete %s  # %s, last commit %s", c.Branch, c.Reason, c.LastCommit.Format("2006-01-02"))
+		if c.PullRequestURL != "" {
+			line += ", " + c.PullRequestURL
+		}
+		b.WriteString(line + "\n")
+	}
+	if err := os.WriteFile(p, b.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("error writing plan %q: %w", p, err)
+	}
+	defer os.Remove(p)
+
+	if err := repo.EditFile(ctx, p); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan %q: %w", p, err)
+	}
+	defer f.Close()
+
+	byName := make(map[string]*candidate)
+	for _, c := range candidates {
+		byName[c.Branch] = c
+	}
+
+	var selected []*candidate
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		tokens := strings.Fields(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("cannot parse plan line %q (expected delete|keep <branch>)", scanner.Text())
+		}
+		c := byName[tokens[1]]
+		if c == nil {
+			return nil, fmt.Errorf("plan line %q does not name a candidate branch", scanner.Text())
+		}
+		switch tokens[0] {
+		case "delete", "d":
+			selected = append(selected, c)
+		case "keep", "k":
+		default:
+			return nil, fmt.Errorf("unknown action %q in plan line %q (expected delete or keep)", tokens[0], scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading plan %q: %w", p, err)
+	}
+
+	return selected, nil
+}
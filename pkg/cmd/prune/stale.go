@@ -0,0 +1,130 @@
+package prune
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// pruneWorktrees removes the administrative files of worktrees whose directories have gone.
+func pruneWorktrees(ctx context.Context, repo *git.Repo, dryRun bool) error {
+	worktrees, err := repo.ListWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+
+	stale := 0
+	for _, worktree := range worktrees {
+		if worktree.Prunable == "" {
+			continue
+		}
+		stale++
+		if dryRun {
+			fmt.Printf("would prune worktree %s (%s)\n", worktree.Path, worktree.Prunable)
+		} else {
+			fmt.Printf("pruning worktree %s (%s)\n", worktree.Path, worktree.Prunable)
+		}
+	}
+	if stale == 0 || dryRun {
+		return nil
+	}
+	return repo.PruneWorktrees(ctx)
+}
+
+// checkedOutBranches returns the branches checked out in any worktree, ignoring stale worktrees.
+func checkedOutBranches(ctx context.Context, repo *git.Repo) (map[string]bool, error) {
+	worktrees, err := repo.ListWorktrees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checkedOut := make(map[string]bool)
+	for _, worktree := range worktrees {
+		if worktree.Prunable != "" {
+			continue
+		}
+		if branchName := worktree.BranchName(); branchName != "" {
+			checkedOut[branchName] = true
+		}
+	}
+	return checkedOut, nil
+}
+
+// pruneRemoteTrackingRefs removes the remote-tracking refs for branches deleted on the remotes.
+// It returns the refs that were (or with dryRun, would be) removed, e.g. origin/foo, mapped to their last sha.
+func pruneRemoteTrackingRefs(ctx context.Context, repo *git.Repo, remotes []*git.Remote, dryRun bool) (map[string]string, error) {
+	prunedRefs := make(map[string]string)
+	for _, remote := range remotes {
+		// Find the refs first, so that we can record where they pointed
+		stale, err := remote.Prune(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range stale {
+			sha, err := repo.RevParse(ctx, "refs/remotes/"+ref)
+			if err != nil {
+				klog.Warningf("cannot resolve stale remote-tracking ref %s: %v", ref, err)
+			}
+			prunedRefs[ref] = sha
+			if dryRun {
+				fmt.Printf("would remove stale remote-tracking ref %s\n", ref)
+			} else {
+				fmt.Printf("removed stale remote-tracking ref %s\n", ref)
+			}
+		}
+		if len(stale) != 0 && !dryRun {
+			if _, err := remote.Prune(ctx, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return prunedRefs, nil
+}
+
+// goneBranch is a local branch whose tracked remote branch has been deleted
+type goneBranch struct {
+	// Upstream is the tracked branch, e.g. origin/foo
+	Upstream string
+
+	// Unpushed is the number of commits on the branch that are not on any remote branch (nor the old tracked branch)
+	Unpushed int
+}
+
+// findGoneBranches returns the local branches whose tracked remote branch has been deleted.
+// prunedRefs are treated as deleted (they may not be yet, in a dry run), and map to their last sha.
+func findGoneBranches(ctx context.Context, repo *git.Repo, prunedRefs map[string]string) (map[string]*goneBranch, error) {
+	upstreams, err := repo.ListBranchUpstreams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gone := make(map[string]*goneBranch)
+	for branchName, upstream := range upstreams {
+		oldTip, pruned := prunedRefs[upstream.Upstream]
+		if !upstream.Gone && !pruned {
+			continue
+		}
+		klog.V(2).Infof("branch %q tracks %q, which is gone", branchName, upstream.Upstream)
+
+		// Commits added after the remote branch was deleted would be lost
+		args := []string{"rev-list", "--count", "refs/heads/" + branchName, "--not", "--remotes"}
+		if oldTip != "" {
+			args = append(args, oldTip)
+		}
+		result, err := repo.ExecGit(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		unpushed, err := strconv.Atoi(strings.TrimSpace(result.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected output from rev-list --count: %q", result.Stdout)
+		}
+		gone[branchName] = &goneBranch{Upstream: upstream.Upstream, Unpushed: unpushed}
+	}
+	return gone, nil
+}
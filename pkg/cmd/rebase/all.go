@@ -0,0 +1,346 @@
+package rebase
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// rebaseResult records what happened to one branch in rebase --all
+type rebaseResult struct {
+	Branch string
+	Onto   string
+	Result string
+	Detail string
+}
+
+// runAll rebases every local branch that isn't merged onto upstream (or onto its parent, for stacked branches,
+// or onto its release branch, for branches based on one).
+// Each rebase is tried first in a temporary worktree; branches are only updated if the rebase succeeds.
+func runAll(ctx context.Context, repo *git.Repo, upstream *git.Branch) error {
+	branches, err := repo.ListLocalBranches(ctx)
+	if err != nil {
+		return err
+	}
+	parents, err := repo.ListBranchParents(ctx)
+	if err != nil {
+		return err
+	}
+	releasePatterns, err := repo.ReleaseBranchPatterns(ctx)
+	if err != nil {
+		return err
+	}
+	upstreamBranches, err := upstream.Remote.ListBranches(ctx)
+	if err != nil {
+		return err
+	}
+	releaseBranches := releasePatterns.Filter(upstreamBranches)
+	tracking, err := repo.ListBranchUpstreams(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Branches checked out in a worktree are updated in place there, rather than by moving the ref
+	worktrees, err := repo.ListWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+	checkedOut := make(map[string]*git.Worktree)
+	for _, worktree := range worktrees {
+		if name := worktree.BranchName(); name != "" && worktree.Prunable == "" {
+			checkedOut[name] = worktree
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "gitflow-rebase-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	worktreeDir := filepath.Join(tmpDir, "worktree")
+	if err := repo.AddDetachedWorktree(ctx, worktreeDir, upstream.Name); err != nil {
+		return err
+	}
+	defer func() {
+		if err := repo.RemoveWorktree(ctx, worktreeDir, true); err != nil {
+			klog.Warningf("error removing temporary worktree %q: %v", worktreeDir, err)
+		}
+	}()
+	scratch, err := git.OpenRepoAt(ctx, worktreeDir)
+	if err != nil {
+		return err
+	}
+	defer scratch.Close()
+
+	local := make(map[string]bool)
+	for _, branch := range branches {
+		local[branch.ShortName] = true
+	}
+
+	var results []*rebaseResult
+	failed := make(map[string]bool)
+	for _, branchName := range orderByParent(branches, parents) {
+		onto := upstream.Name
+		parent := parents[branchName]
+		if !local[parent] {
+			parent = ""
+		}
+		if parent != "" {
+			onto = parent
+		}
+		result := &rebaseResult{Branch: branchName, Onto: onto}
+		results = append(results, result)
+
+		if releasePatterns.Match(branchName) {
+			result.Result = "skipped"
+			result.Detail = "release branch"
+			continue
+		}
+		if parent != "" && failed[parent] {
+			result.Result = "skipped"
+			result.Detail = "parent " + parent + " was not rebased"
+			failed[branchName] = true
+			continue
+		}
+
+		if parent == "" {
+			base, err := findBase(ctx, repo, upstream, releaseBranches, tracking, branchName)
+			if err != nil {
+				result.Result = "error"
+				result.Detail = err.Error()
+				failed[branchName] = true
+				continue
+			}
+			if base == "" {
+				result.Result = "skipped"
+				result.Detail = "based on a release branch, but cannot tell which"
+				failed[branchName] = true
+				continue
+			}
+			onto = base
+			result.Onto = onto
+
+			merged, err := isMerged(ctx, repo, onto, "refs/heads/"+branchName)
+			if err != nil {
+				result.Result = "error"
+				result.Detail = err.Error()
+				failed[branchName] = true
+				continue
+			}
+			if merged {
+				result.Result = "skipped"
+				result.Detail = "merged (use gitflow prune)"
+				continue
+			}
+		}
+
+		if err := rebaseInWorktree(ctx, repo, scratch, branchName, parent, onto, checkedOut[branchName], result); err != nil {
+			result.Result = "error"
+			result.Detail = err.Error()
+		}
+		if result.Result != "rebased" && result.Result != "up to date" {
+			failed[branchName] = true
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "BRANCH\tONTO\tRESULT\tDETAIL\n")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Branch, r.Onto, r.Result, r.Detail)
+	}
+	return w.Flush()
+}
+
+// rebaseInWorktree rebases the branch in the scratch worktree, and if that succeeds, updates the branch.
+// Stacked branches are rebased onto their parent, other branches onto the base (upstream or a release branch).
+func rebaseInWorktree(ctx context.Context, repo *git.Repo, scratch *git.Repo, branchName string, parent string, base string, worktree *git.Worktree, result *rebaseResult) error {
+	oldTip, err := repo.RevParse(ctx, "refs/heads/"+branchName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := scratch.ExecGit(ctx, "checkout", "--detach", oldTip); err != nil {
+		return err
+	}
+
+	args := []string{"rebase"}
+	if parent == "" {
+		args = append(args, base)
+	} else {
+		// As for stacks, the fork point finds the old base of the branch even though the parent was rewritten
+		forkPoint, err := repo.ForkPoint(ctx, "refs/heads/"+parent, oldTip)
+		if err != nil {
+			forkPoint, err = repo.MergeBase(ctx, "refs/heads/"+parent, oldTip)
+			if err != nil {
+				return err
+			}
+		}
+		args = append(args, "--onto", "refs/heads/"+parent, forkPoint)
+	}
+	if _, err := scratch.ExecGit(ctx, args...); err != nil {
+		conflicts, conflictsErr := scratch.ConflictedFiles(ctx)
+		if conflictsErr != nil {
+			klog.Warningf("error listing conflicted files: %v", conflictsErr)
+		}
+		if _, err := scratch.ExecGit(ctx, "rebase", "--abort"); err != nil {
+			klog.Warningf("error aborting rebase of %q: %v", branchName, err)
+		}
+		result.Result = "conflict"
+		if len(conflicts) != 0 {
+			result.Detail = strings.Join(conflicts, ", ")
+		} else {
+			result.Detail = err.Error()
+		}
+		return nil
+	}
+
+	newTip, err := scratch.RevParse(ctx, "HEAD")
+	if err != nil {
+		return err
+	}
+	if newTip == oldTip {
+		result.Result = "up to date"
+		return nil
+	}
+
+	if worktree != nil {
+		// reset --keep moves the branch and updates the working tree, but refuses to overwrite local changes
+		w, err := git.OpenRepoAt(ctx, worktree.Path)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		if r, err := w.ExecGit(ctx, "reset", "--keep", newTip); err != nil {
+			result.Result = "conflict"
+			result.Detail = fmt.Sprintf("rebased cleanly, but local changes in %s prevent updating: %s", worktree.Path, strings.TrimSpace(r.Stderr))
+			return nil
+		}
+	} else {
+		if err := repo.UpdateRef(ctx, "refs/heads/"+branchName, newTip, "gitflow rebase --all"); err != nil {
+			return err
+		}
+	}
+
+	result.Result = "rebased"
+	result.Detail = fmt.Sprintf("%s -> %s", shortSHA(oldTip), shortSHA(newTip))
+	return nil
+}
+
+// cherryPickBranchPrefix is the prefix of the branches created by cherry, which end with -<target-branch>
+const cherryPickBranchPrefix = "automated-cherry-pick-of-"
+
+// findBase returns the branch that an unstacked branch should be rebased onto: upstream, unless the branch
+// is based on a release branch, in which case it is rebased onto that release branch.
+// It returns "" if the branch is based on a release branch, but we can't tell which.
+func findBase(ctx context.Context, repo *git.Repo, upstream *git.Branch, releaseBranches []*git.Branch, tracking map[string]*git.BranchUpstream, branchName string) (string, error) {
+	// Branches created by cherry name their target branch
+	if strings.HasPrefix(branchName, cherryPickBranchPrefix) {
+		base := ""
+		for _, releaseBranch := range releaseBranches {
+			if strings.HasSuffix(branchName, "-"+releaseBranch.ShortName) && len(releaseBranch.Name) > len(base) {
+				base = releaseBranch.Name
+			}
+		}
+		if base != "" {
+			return base, nil
+		}
+	}
+
+	// A branch that tracks a release branch is based on it
+	if t := tracking[branchName]; t != nil && !t.Gone {
+		for _, releaseBranch := range releaseBranches {
+			if t.Upstream == releaseBranch.Name {
+				return releaseBranch.Name, nil
+			}
+		}
+	}
+
+	// Otherwise, the branch is based on a release branch if it shares commits with it that aren't on upstream
+	var based []string
+	for _, releaseBranch := range releaseBranches {
+		if releaseBranch.Name == upstream.Name {
+			continue
+		}
+		mergeBase, err := repo.MergeBase(ctx, releaseBranch.Name, "refs/heads/"+branchName)
+		if err != nil {
+			// No common history
+			continue
+		}
+		if _, err := repo.ExecGit(ctx, "merge-base", "--is-ancestor", mergeBase, upstream.Name); err != nil {
+			based = append(based, releaseBranch.Name)
+		}
+	}
+	switch len(based) {
+	case 0:
+		return upstream.Name, nil
+	case 1:
+		return based[0], nil
+	default:
+		klog.Infof("branch %q shares commits with several release branches: %v", branchName, based)
+		return "", nil
+	}
+}
+
+// isMerged returns true if the branch has landed on target, directly or by squash or rebase merge.
+func isMerged(ctx context.Context, repo *git.Repo, target, branch string) (bool, error) {
+	if _, err := repo.ExecGit(ctx, "merge-base", "--is-ancestor", branch, target); err == nil {
+		return true, nil
+	}
+	rebased, err := repo.IsRebaseMerged(ctx, target, branch)
+	if err != nil || rebased {
+		return rebased, err
+	}
+	return repo.IsSquashMerged(ctx, target, branch)
+}
+
+// orderByParent returns the branch names so that each stacked branch comes after its parent.
+// Branches that are not stacked keep their original order.
+func orderByParent(branches []*git.Branch, parents map[string]string) []string {
+	local := make(map[string]bool)
+	for _, branch := range branches {
+		local[branch.ShortName] = true
+	}
+	children := make(map[string][]string)
+	var roots []string
+	for _, branch := range branches {
+		parent := parents[branch.ShortName]
+		if parent != "" && local[parent] {
+			children[parent] = append(children[parent], branch.ShortName)
+		} else {
+			roots = append(roots, branch.ShortName)
+		}
+	}
+	for _, c := range children {
+		sort.Strings(c)
+	}
+
+	var ordered []string
+	seen := make(map[string]bool)
+	queue := roots
+	for len(queue) != 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		ordered = append(ordered, name)
+		queue = append(queue, children[name]...)
+	}
+	return ordered
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -2,29 +2,60 @@ package rebase
 
 import (
 	"context"
+	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
 
 	"github.com/justinsb/gitflow/pkg/git"
 )
 
 func AddCommand(ctx context.Context, parent *cobra.Command) {
 	cmd := &cobra.Command{
-		Use: "rebase",
+		Use:   "rebase",
+		Short: "Rebase the current branch (and any branches stacked on it) onto upstream",
+		Long: `Rebase the current branch onto upstream.
+
+Branches can be stacked on other local branches by recording a parent (with --parent,
+stored as branch.<name>.gitflow-parent in git config).  When the current branch is part
+of a stack, the whole stack is rebased: the bottom branch onto upstream, and each other
+branch onto the new tip of its parent.
+
+With --all, every local branch that isn't merged is rebased (stacked branches onto their parent,
+and branches based on a release branch, such as those created by cherry, onto that release branch).
+Each rebase is first tried in a temporary worktree: branches that rebase cleanly are updated,
+and branches that conflict are left untouched and listed with the conflicting paths.`,
 	}
 	var opt Options
 	opt.InitDefaults()
 
+	var autostash bool
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("autostash") {
+			opt.Autostash = &autostash
+		}
 		return Run(cmd.Context(), opt)
 	}
+	cmd.Flags().BoolVar(&autostash, "autostash", autostash, "stash uncommitted changes and restore them afterwards (default from gitflow.autostash)")
 	cmd.Flags().BoolVarP(&opt.Interactive, "interactive", "i", opt.Interactive, "run rebase interactively")
+	cmd.Flags().BoolVar(&opt.All, "all", opt.All, "rebase every local branch that isn't merged, skipping any that conflict")
+	cmd.Flags().StringVar(&opt.Parent, "parent", opt.Parent, "record the local branch that the current branch is stacked on")
 	parent.AddCommand(cmd)
 }
 
 type Options struct {
 	Interactive bool
 	Verbose     bool
+
+	// Parent, if set, is recorded as the parent branch of the current branch before rebasing
+	Parent string
+
+	// All rebases every local branch, rather than the current branch
+	All bool
+
+	// Autostash, if set, overrides the gitflow.autostash setting
+	Autostash *bool
 }
 
 func (o *Options) InitDefaults() {
@@ -43,20 +74,185 @@ func Run(ctx context.Context, opt Options) error {
 		return err
 	}
 
+	if opt.All {
+		if opt.Interactive || opt.Parent != "" {
+			return fmt.Errorf("--all cannot be combined with --interactive or --parent")
+		}
+		// We rebase in a scratch worktree, and update checked-out branches with reset --keep,
+		// so uncommitted changes and a detached HEAD are fine
+		operation, err := repo.InProgressOperation(ctx)
+		if err != nil {
+			return err
+		}
+		if operation != "" {
+			return fmt.Errorf("a %s is in progress; finish or abort it first (%s)", operation, git.RecoveryHint(operation))
+		}
+		if err := upstream.Remote.Fetch(ctx); err != nil {
+			return err
+		}
+		return runAll(ctx, repo, upstream)
+	}
+
+	preflight, err := repo.Preflight(ctx, git.PreflightOptions{Autostash: opt.Autostash})
+	if err != nil {
+		return err
+	}
+	defer preflight.Restore(ctx)
+
 	if err := upstream.Remote.Fetch(ctx); err != nil {
 		return err
 	}
 
+	currentBranch, err := repo.CurrentBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	if opt.Parent != "" {
+		if _, err := repo.RevParse(ctx, "refs/heads/"+opt.Parent); err != nil {
+			return fmt.Errorf("parent branch %q is not a local branch", opt.Parent)
+		}
+		if err := repo.SetBranchParent(ctx, currentBranch.ShortName, opt.Parent); err != nil {
+			return err
+		}
+	}
+
+	parents, err := repo.ListBranchParents(ctx)
+	if err != nil {
+		return err
+	}
+	branches, err := repo.ListLocalBranches(ctx)
+	if err != nil {
+		return err
+	}
+	local := make(map[string]bool)
+	for _, branch := range branches {
+		local[branch.ShortName] = true
+	}
+	for child, parent := range parents {
+		if local[parent] {
+			continue
+		}
+		// The parent was deleted (typically merged and pruned), so the child is now the bottom of its stack
+		delete(parents, child)
+		if !local[child] {
+			continue
+		}
+		klog.Warningf("parent %q of branch %q no longer exists; unstacking %q", parent, child, child)
+		if err := repo.SetBranchParent(ctx, child, ""); err != nil {
+			return err
+		}
+	}
+	children := make(map[string][]string)
+	for child, parent := range parents {
+		children[parent] = append(children[parent], child)
+	}
+	for _, c := range children {
+		sort.Strings(c)
+	}
+
+	// Find the bottom of the stack containing the current branch
+	root := currentBranch.ShortName
+	seen := make(map[string]bool)
+	for parents[root] != "" {
+		if seen[root] {
+			return fmt.Errorf("branch parents form a cycle at %q", root)
+		}
+		seen[root] = true
+		root = parents[root]
+	}
+
+	if root == currentBranch.ShortName && len(children[root]) == 0 {
+		// Not stacked; just rebase the current branch
+		args := []string{"rebase"}
+		if opt.Interactive {
+			args = append(args, "-i")
+		}
+		args = append(args, "--autosquash")
+		args = append(args, upstream.Name)
+
+		if _, err := repo.ExecGitInteractive(ctx, args...); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	var restacked []string
+
+	oldRootTip, err := repo.RevParse(ctx, "refs/heads/"+root)
+	if err != nil {
+		return err
+	}
 	args := []string{"rebase"}
-	if opt.Interactive {
+	if opt.Interactive && root == currentBranch.ShortName {
 		args = append(args, "-i")
 	}
-	args = append(args, "--autosquash")
-	args = append(args, upstream.Name)
-
+	args = append(args, "--autosquash", upstream.Name, root)
 	if _, err := repo.ExecGitInteractive(ctx, args...); err != nil {
+		return fmt.Errorf("rebasing %q onto %q stopped; resolve and re-run to continue restacking: %w", root, upstream.Name, err)
+	}
+	newRootTip, err := repo.RevParse(ctx, "refs/heads/"+root)
+	if err != nil {
 		return err
 	}
+	if newRootTip != oldRootTip {
+		restacked = append(restacked, fmt.Sprintf("%s onto %s", root, upstream.Name))
+	}
+
+	// Walk the tree top-down, so that each branch's parent has already been rebased
+	queue := []string{root}
+	for len(queue) != 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		for _, child := range children[parent] {
+			queue = append(queue, child)
+
+			oldTip, err := repo.RevParse(ctx, "refs/heads/"+child)
+			if err != nil {
+				return fmt.Errorf("branch %q (stacked on %q) not found: %w", child, parent, err)
+			}
+
+			// The fork point uses the reflog of the parent, so it finds the old base even though the parent was rewritten
+			base, err := repo.ForkPoint(ctx, "refs/heads/"+parent, child)
+			if err != nil {
+				base, err = repo.MergeBase(ctx, "refs/heads/"+parent, child)
+				if err != nil {
+					return err
+				}
+			}
+
+			args := []string{"rebase"}
+			if opt.Interactive && child == currentBranch.ShortName {
+				args = append(args, "-i")
+			}
+			args = append(args, "--autosquash", "--onto", parent, base, child)
+			if _, err := repo.ExecGitInteractive(ctx, args...); err != nil {
+				return fmt.Errorf("rebasing %q onto %q stopped; resolve and re-run to continue restacking: %w", child, parent, err)
+			}
+
+			newTip, err := repo.RevParse(ctx, "refs/heads/"+child)
+			if err != nil {
+				return err
+			}
+			if newTip != oldTip {
+				restacked = append(restacked, fmt.Sprintf("%s onto %s", child, parent))
+			}
+		}
+	}
+
+	if err := repo.Checkout(ctx, currentBranch); err != nil {
+		return err
+	}
+
+	if len(restacked) == 0 {
+		fmt.Printf("stack rooted at %q is already up to date\n", root)
+	} else {
+		fmt.Printf("restacked:\n")
+		for _, s := range restacked {
+			fmt.Printf("  %s\n", s)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,397 @@
+package stack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func AddCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "stack",
+		Short: "Split the current branch into a stack of dependent pull requests",
+		Long: `Split the commits since upstream into a stack of dependent pull requests.
+
+Commits are grouped using a "` + trailerKey + `: <name>" trailer in the commit message;
+commits without the trailer belong to the same group as the commit before them.
+With --interactive, the plan is opened in your editor instead.
+
+Each group gets a branch named <prefix>-<group>, pushed to your fork, and a pull request.
+Every pull request body includes a table of the whole stack.
+
+Pull requests can only be based on branches in the upstream repository, so each pull
+request is based on the previous one only when your fork is the upstream repository
+(you push branches there).  Otherwise every pull request is based on upstream, and
+includes the commits of the pull requests below it; review them in order, using the table.
+
+Re-run the command after updating the branch; pull requests that have merged are
+skipped, and the remaining pull requests are retargeted and their tables refreshed.`,
+		Args: cobra.NoArgs,
+	}
+	var opt Options
+	opt.InitDefaults()
+
+	cmd.Flags().BoolVarP(&opt.Interactive, "interactive", "i", opt.Interactive, "edit the grouping plan in your editor")
+	cmd.Flags().BoolVar(&opt.DryRun, "dry-run", opt.DryRun, "preview only, don't make changes")
+	cmd.Flags().BoolVar(&opt.Draft, "draft", opt.Draft, "create new pull requests as drafts")
+	cmd.Flags().StringVar(&opt.Prefix, "prefix", opt.Prefix, "prefix for the stack branch names (defaults to the current branch name)")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return Run(cmd.Context(), opt)
+	}
+	parent.AddCommand(cmd)
+}
+
+type Options struct {
+	Interactive bool
+	DryRun      bool
+	Draft       bool
+
+	// Prefix is the prefix for the stack branch names
+	Prefix string
+}
+
+func (o *Options) InitDefaults() {
+
+}
+
+// trailerKey is the commit trailer that assigns a commit to a group
+const trailerKey = "Gitflow-Stack"
+
+// stackMarker separates the description of a pull request from the stack table we maintain
+const stackMarker = "<!-- gitflow-stack -->"
+
+type group struct {
+	Name    string
+	Commits []*git.Commit
+
+	BranchName string
+	Base       string
+	PR         *git.GithubPullRequest
+}
+
+func (g *group) Merged() bool {
+	return g.PR != nil && g.PR.Merged()
+}
+
+// Description builds the pull request description from the commit messages, without our grouping trailer.
+// For a group of several commits, each commit after the first contributes its subject and body.
+func (g *group) Description() string {
+	var sections []string
+	for i, commit := range g.Commits {
+		var lines []string
+		for _, line := range strings.Split(commit.Body, "\n") {
+			if key, _, found := strings.Cut(line, ":"); found && strings.EqualFold(strings.TrimSpace(key), trailerKey) {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		body := strings.TrimSpace(strings.Join(lines, "\n"))
+		if i != 0 {
+			// The first subject is the title
+			body = strings.TrimSpace(commit.Subject + "\n\n" + body)
+		}
+		if body != "" {
+			sections = append(sections, body)
+		}
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+func Run(ctx context.Context, opt Options) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	forkRemote, err := repo.FindForkRemoteForPullRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	upstream, err := repo.FindUpstreamBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	currentBranch, err := repo.CurrentBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	commits, err := repo.ListCommits(ctx, upstream.Name+"..HEAD")
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("no commits found since %s", upstream.Name)
+	}
+
+	groups, err := groupByTrailer(commits)
+	if err != nil {
+		return err
+	}
+
+	if opt.Interactive {
+		groups, err = editPlan(ctx, repo, commits, groups)
+		if err != nil {
+			return err
+		}
+	}
+
+	prefix := opt.Prefix
+	if prefix == "" {
+		prefix = currentBranch.ShortName
+	}
+	for _, g := range groups {
+		g.BranchName = prefix + "-" + g.Name
+	}
+
+	forkInfo, err := forkRemote.GithubInfo(ctx)
+	if err != nil {
+		return err
+	}
+	upstreamInfo, err := upstream.Remote.GithubInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		prs, err := upstream.Remote.ListPullRequestsForBranch(ctx, forkInfo.Organization, g.BranchName, "all")
+		if err != nil {
+			return err
+		}
+		for _, pr := range prs {
+			if pr.State() == "open" || pr.Merged() {
+				g.PR = pr
+				break
+			}
+		}
+	}
+
+	// Pull requests can only target branches in the upstream repo,
+	// so we can only chain the bases when the stack branches are pushed there.
+	canChain := *forkInfo == *upstreamInfo
+	base := upstream.ShortName
+	unmerged := 0
+	for _, g := range groups {
+		if g.Merged() {
+			continue
+		}
+		unmerged++
+		g.Base = base
+		if canChain {
+			base = g.BranchName
+		}
+	}
+	if !canChain && unmerged > 1 {
+		klog.Warningf("stack branches are pushed to %s/%s, not %s/%s, so the pull requests cannot be based on each other; each will be based on %s and include the commits of the pull requests below it",
+			forkInfo.Organization, forkInfo.Repository, upstreamInfo.Organization, upstreamInfo.Repository, upstream.ShortName)
+	}
+
+	for _, g := range groups {
+		status := "new"
+		if g.PR != nil {
+			status = fmt.Sprintf("#%d", g.PR.Number())
+			if g.Merged() {
+				status += " (merged)"
+			}
+		}
+		fmt.Printf("%s [%s] base=%s\n", g.BranchName, status, g.Base)
+		for _, commit := range g.Commits {
+			fmt.Printf("  %s %s\n", commit.ShortSHA(), commit.Subject)
+		}
+	}
+
+	if opt.DryRun {
+		return nil
+	}
+
+	for _, g := range groups {
+		if g.Merged() {
+			continue
+		}
+		tip := g.Commits[len(g.Commits)-1]
+		if _, err := repo.ExecGit(ctx, "branch", "-f", g.BranchName, tip.SHA); err != nil {
+			return err
+		}
+		if err := repo.Push(ctx, forkRemote, git.PushOptions{
+			ForceWithLease: g.BranchName,
+			Refspecs:       []string{g.BranchName + ":" + g.BranchName},
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range groups {
+		if g.Merged() || g.PR != nil {
+			continue
+		}
+		prNumber, prURL, err := upstream.Remote.CreatePullRequest(ctx, git.CreatePullRequestOptions{
+			Base:  g.Base,
+			Head:  forkInfo.Organization + ":" + g.BranchName,
+			Title: g.Commits[0].Subject,
+			Body:  g.Description(),
+			Draft: opt.Draft,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created #%d for %s: %s\n", prNumber, g.BranchName, prURL)
+		pr, err := upstream.Remote.GetPullRequest(ctx, fmt.Sprintf("%d", prNumber))
+		if err != nil {
+			return err
+		}
+		g.PR = pr
+	}
+
+	for _, g := range groups {
+		if g.Merged() {
+			continue
+		}
+		description, _, _ := strings.Cut(g.PR.Body(), stackMarker)
+		body := strings.TrimSpace(description) + "\n\n" + renderStackTable(groups, g)
+		if err := upstream.Remote.EditPullRequest(ctx, g.PR.Number(), git.EditPullRequestOptions{
+			Base: g.Base,
+			Body: body,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// groupByTrailer splits the commits into groups, using the stack trailer.
+func groupByTrailer(commits []*git.Commit) ([]*group, error) {
+	var groups []*group
+	var current *group
+	for _, commit := range commits {
+		name := ""
+		if values := commit.Trailer(trailerKey); len(values) != 0 {
+			name = values[len(values)-1]
+		}
+		if current == nil && name == "" {
+			name = "1"
+		}
+		if current == nil || (name != "" && name != current.Name) {
+			current = &group{Name: name}
+			groups = append(groups, current)
+		}
+		current.Commits = append(current.Commits, commit)
+	}
+	return groups, validateGroups(groups)
+}
+
+// validateGroups checks that each group name is only used for one contiguous run of commits.
+func validateGroups(groups []*group) error {
+	seen := make(map[string]bool)
+	for _, g := range groups {
+		if strings.ContainsAny(g.Name, " \t") {
+			return fmt.Errorf("invalid group name %q", g.Name)
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("commits in group %q are not contiguous; reorder them with rebase -i first", g.Name)
+		}
+		seen[g.Name] = true
+	}
+	return nil
+}
+
+// editPlan writes the grouping to a file, lets the user edit it, and parses the result.
+func editPlan(ctx context.Context, repo *git.Repo, commits []*git.Commit, groups []*group) ([]*group, error) {
+	gitDir, err := repo.GitDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := filepath.Join(gitDir, "GITFLOW_STACK_PLAN")
+
+	var b bytes.Buffer
+	b.WriteString("# Assign each commit to a pull request by editing the group in the first column.\n")
+	b.WriteString("# Commits must stay in order; consecutive commits in the same group share a pull request.\n")
+	b.WriteString("#\n")
+	for _, g := range groups {
+		for _, commit := range g.Commits {
+			b.WriteString(fmt.Sprintf("%s %s %s\n", g.Name, commit.ShortSHA(), commit.Subject))
+		}
+	}
+	if err := os.WriteFile(p, b.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("error writing plan %q: %w", p, err)
+	}
+	defer os.Remove(p)
+
+	if err := repo.EditFile(ctx, p); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan %q: %w", p, err)
+	}
+	defer f.Close()
+
+	var newGroups []*group
+	var current *group
+	i := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens := strings.Fields(line)
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("cannot parse plan line %q (expected <group> <sha>)", line)
+		}
+		if i >= len(commits) || !strings.HasPrefix(commits[i].SHA, tokens[1]) {
+			return nil, fmt.Errorf("plan line %q does not match the expected commit order", line)
+		}
+		if current == nil || current.Name != tokens[0] {
+			current = &group{Name: tokens[0]}
+			newGroups = append(newGroups, current)
+		}
+		current.Commits = append(current.Commits, commits[i])
+		i++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading plan %q: %w", p, err)
+	}
+	if i != len(commits) {
+		return nil, fmt.Errorf("plan has %d commits, expected %d (commits cannot be dropped)", i, len(commits))
+	}
+
+	return newGroups, validateGroups(newGroups)
+}
+
+// renderStackTable builds the markdown table listing the whole stack, highlighting the current pull request.
+func renderStackTable(groups []*group, current *group) string {
+	var b bytes.Buffer
+	b.WriteString(stackMarker + "\n")
+	b.WriteString("**Stack** (merge in order, starting with the first row):\n\n")
+	b.WriteString("| | Pull request | Title |\n")
+	b.WriteString("| --- | --- | --- |\n")
+	for _, g := range groups {
+		marker := ""
+		if g == current {
+			marker = "→"
+		}
+		ref := "(not created)"
+		if g.PR != nil {
+			ref = fmt.Sprintf("#%d", g.PR.Number())
+			if g.Merged() {
+				ref += " (merged)"
+			}
+		}
+		b.WriteString(fmt.Sprintf("| %s | %s | %s |\n", marker, ref, g.Commits[0].Subject))
+	}
+	return b.String()
+}
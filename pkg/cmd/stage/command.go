@@ -1,17 +1,16 @@
 package stage
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"regexp"
-	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/justinsb/gitflow/pkg/git"
 )
 
 func AddCommand(ctx context.Context, parent *cobra.Command) {
@@ -59,19 +58,18 @@ func Run(ctx context.Context, opt Options, args []string) error {
 	}
 
 	// 2. Parse the diff into hunks
-	hunks := parseDiff(bytes.NewReader(stdout.Bytes()))
+	hunks, err := git.ParseDiff(bytes.NewReader(stdout.Bytes()))
+	if err != nil {
+		return err
+	}
 
 	var buffer bytes.Buffer
-	matchedCount := 0
-
-	for _, hunk := range hunks {
-		// Only match against the content of the hunk (lines starting with +)
-		if re.MatchString(hunk.content) {
-			buffer.WriteString(hunk.header)
-			buffer.WriteString(hunk.content)
-			matchedCount++
-		}
+	matched := git.SelectHunksByPattern(hunks, re)
+	for _, hunk := range matched {
+		buffer.WriteString(hunk.Header)
+		buffer.WriteString(hunk.Content)
 	}
+	matchedCount := len(matched)
 
 	if matchedCount == 0 {
 		fmt.Fprintf(os.Stderr, "No hunks matched the pattern.")
@@ -95,43 +93,3 @@ func Run(ctx context.Context, opt Options, args []string) error {
 	fmt.Fprintf(os.Stderr, "Successfully staged %d hunk(s) matching '%s'\n", matchedCount, opt.Pattern)
 	return nil
 }
-
-type hunk struct {
-	header  string // The diff/index/---/+++/@@ lines
-	content string // The actual + and - lines
-}
-
-func parseDiff(r io.Reader) []hunk {
-	var hunks []hunk
-	scanner := bufio.NewScanner(r)
-
-	var currentHunk *hunk
-	var headerLines []string
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// New file header or hunk header starts
-		if strings.HasPrefix(line, "diff --git") {
-			headerLines = []string{line}
-		} else if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "index") {
-			headerLines = append(headerLines, line)
-		} else if strings.HasPrefix(line, "@@") {
-			if currentHunk != nil {
-				hunks = append(hunks, *currentHunk)
-			}
-			currentHunk = &hunk{}
-			currentHunk.header = strings.Join(headerLines, "\n") + "\n"
-			currentHunk.content = line + "\n"
-		} else {
-			// It's a content line (+ or -)
-			if currentHunk != nil {
-				currentHunk.content += line + "\n"
-			}
-		}
-	}
-	if currentHunk != nil {
-		hunks = append(hunks, *currentHunk)
-	}
-	return hunks
-}
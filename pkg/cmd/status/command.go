@@ -0,0 +1,243 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func AddCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "shows local branches with their upstream, fork and pull request status",
+	}
+	var opt Options
+	opt.InitDefaults()
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return Run(cmd.Context(), opt)
+	}
+	cmd.Flags().IntVar(&opt.N, "n", opt.N, "max number of branches to show")
+	cmd.Flags().StringVarP(&opt.Output, "output", "o", opt.Output, "output format (table or json)")
+	cmd.Flags().BoolVar(&opt.Fetch, "fetch", opt.Fetch, "fetch the upstream and fork remotes first")
+	parent.AddCommand(cmd)
+}
+
+type Options struct {
+	N      int
+	Output string
+	Fetch  bool
+}
+
+func (o *Options) InitDefaults() {
+	o.N = 10
+	o.Output = "table"
+}
+
+type BranchStatus struct {
+	Branch string `json:"branch"`
+
+	// Ahead and Behind are relative to the upstream branch
+	Ahead  int `json:"ahead"`
+	Behind int `json:"behind"`
+
+	// Unpushed is the number of commits not on the fork, or -1 if the branch has never been pushed
+	Unpushed int `json:"unpushed"`
+
+	PullRequest *PullRequestInfo `json:"pullRequest,omitempty"`
+
+	// Ready is true if the pull request can be merged
+	Ready bool `json:"ready"`
+	// Blockers lists the reasons the pull request cannot be merged
+	Blockers []string `json:"blockers,omitempty"`
+}
+
+type PullRequestInfo struct {
+	Number         int    `json:"number"`
+	URL            string `json:"url"`
+	State          string `json:"state"`
+	Draft          bool   `json:"draft"`
+	ReviewDecision string `json:"reviewDecision,omitempty"`
+	CI             string `json:"ci,omitempty"`
+	Mergeable      string `json:"mergeable,omitempty"`
+}
+
+func Run(ctx context.Context, opt Options) error {
+	switch opt.Output {
+	case "table", "json":
+	default:
+		return fmt.Errorf("unknown output format %q (expected table or json)", opt.Output)
+	}
+
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	upstream, err := repo.FindUpstreamBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	forkRemote, err := repo.FindForkRemoteForPullRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	if opt.Fetch {
+		if err := upstream.Remote.Fetch(ctx); err != nil {
+			return err
+		}
+		if forkRemote.Name != upstream.Remote.Name {
+			if err := forkRemote.Fetch(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	branches, err := repo.ListLocalBranches(ctx)
+	if err != nil {
+		return err
+	}
+	if opt.N > 0 && len(branches) > opt.N {
+		branches = branches[:opt.N]
+	}
+
+	// We look up all our pull requests in one call, rather than one per branch
+	pullRequests := make(map[string]*git.PullRequestStatus)
+	forkInfo, err := forkRemote.GithubInfo(ctx)
+	if err != nil {
+		return err
+	}
+	prStatuses, err := upstream.Remote.ListPullRequestStatuses(ctx, forkInfo.Organization)
+	if err != nil {
+		klog.Warningf("unable to list pull requests: %v", err)
+	}
+	for _, pr := range prStatuses {
+		if !strings.EqualFold(pr.HeadRepositoryOwner.Login, forkInfo.Organization) {
+			continue
+		}
+		// The list is newest first, so we keep the first, unless a later one is open and it isn't
+		existing := pullRequests[pr.HeadRefName]
+		if existing == nil || (pr.State == "OPEN" && existing.State != "OPEN") {
+			pullRequests[pr.HeadRefName] = pr
+		}
+	}
+
+	var statuses []*BranchStatus
+	for _, branch := range branches {
+		status := &BranchStatus{Branch: branch.ShortName}
+
+		status.Ahead, status.Behind, err = repo.AheadBehind(ctx, upstream.Name, branch.Name)
+		if err != nil {
+			return err
+		}
+
+		status.Unpushed = -1
+		pushedRef := "refs/remotes/" + forkRemote.Name + "/" + branch.ShortName
+		if _, err := repo.RevParse(ctx, pushedRef); err == nil {
+			status.Unpushed, _, err = repo.AheadBehind(ctx, pushedRef, branch.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pr := pullRequests[branch.ShortName]; pr != nil {
+			status.PullRequest = &PullRequestInfo{
+				Number:         pr.Number,
+				URL:            pr.URL,
+				State:          pr.State,
+				Draft:          pr.IsDraft,
+				ReviewDecision: pr.ReviewDecision,
+				CI:             pr.CIState(),
+				Mergeable:      pr.Mergeable,
+			}
+		}
+
+		status.Blockers = findBlockers(status)
+		status.Ready = status.PullRequest != nil && status.PullRequest.State == "OPEN" && len(status.Blockers) == 0
+
+		statuses = append(statuses, status)
+	}
+
+	switch opt.Output {
+	case "json":
+		b, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error building json: %w", err)
+		}
+		fmt.Println(string(b))
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "BRANCH\tAHEAD\tBEHIND\tUNPUSHED\tPR\tSTATE\tREVIEW\tCI\tREADY\n")
+		for _, s := range statuses {
+			unpushed := "-"
+			if s.Unpushed >= 0 {
+				unpushed = strconv.Itoa(s.Unpushed)
+			}
+			prNumber, prState, review, ci := "", "", "", ""
+			if pr := s.PullRequest; pr != nil {
+				prNumber = "#" + strconv.Itoa(pr.Number)
+				prState = strings.ToLower(pr.State)
+				if pr.Draft {
+					prState += " (draft)"
+				}
+				review = strings.ToLower(pr.ReviewDecision)
+				ci = strings.ToLower(pr.CI)
+			}
+			ready := ""
+			if s.Ready {
+				ready = "yes"
+			} else if s.PullRequest != nil && s.PullRequest.State == "OPEN" {
+				ready = strings.Join(s.Blockers, ",")
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Branch, s.Ahead, s.Behind, unpushed, prNumber, prState, review, ci, ready)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findBlockers returns the reasons an open pull request is not ready to merge.
+func findBlockers(s *BranchStatus) []string {
+	pr := s.PullRequest
+	if pr == nil || pr.State != "OPEN" {
+		return nil
+	}
+
+	var blockers []string
+	if pr.Draft {
+		blockers = append(blockers, "draft")
+	}
+	if s.Unpushed != 0 {
+		blockers = append(blockers, "unpushed")
+	}
+	switch pr.ReviewDecision {
+	case "CHANGES_REQUESTED":
+		blockers = append(blockers, "changes-requested")
+	case "REVIEW_REQUIRED":
+		blockers = append(blockers, "needs-review")
+	}
+	switch pr.CI {
+	case "FAILURE":
+		blockers = append(blockers, "ci-failing")
+	case "PENDING":
+		blockers = append(blockers, "ci-pending")
+	}
+	if pr.Mergeable == "CONFLICTING" {
+		blockers = append(blockers, "conflicts")
+	}
+	return blockers
+}
@@ -2,6 +2,7 @@ package toc
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/spf13/cobra"
 
@@ -10,7 +11,8 @@ import (
 
 func AddCommand(ctx context.Context, parent *cobra.Command) {
 	cmd := &cobra.Command{
-		Use: "toc",
+		Use:   "toc",
+		Short: "lists the commits since upstream, numbered from oldest",
 	}
 	var opt Options
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
@@ -34,9 +36,15 @@ func Run(ctx context.Context, opt Options) error {
 		return err
 	}
 
-	if _, err := repo.ExecGitInteractive(ctx, "log", "--oneline", upstream.Name+"...", "--reverse"); err != nil {
+	_, commits, err := repo.ListBranchCommits(ctx, upstream)
+	if err != nil {
 		return err
 	}
 
+	// The numbers are the indexes accepted by drop, move, reword, squash and split
+	for i, commit := range commits {
+		fmt.Printf("%3d %s %s\n", i+1, commit.ShortSHA(), commit.Subject)
+	}
+
 	return nil
 }
@@ -0,0 +1,218 @@
+package where
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+func AddCommand(ctx context.Context, parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "where <pr-number-or-url>",
+		Short: "reports which release branches contain a pull request",
+		Long: `Reports which upstream release branches contain a pull request.
+Release branches are main, master and release-*, unless configured with gitflow.release.pattern.
+
+A branch contains the pull request if the commits it landed as are ancestors of the branch,
+or if they were cherry-picked: a commit on the branch has the same patch-id,
+or records the original commit with a "(cherry picked from commit ...)" line.
+
+Open pull requests whose title references the original pull request are listed as pending backports.`,
+		Args: cobra.ExactArgs(1),
+	}
+	var opt Options
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return Run(cmd.Context(), opt, args[0])
+	}
+	parent.AddCommand(cmd)
+}
+
+type Options struct {
+}
+
+func Run(ctx context.Context, opt Options, arg string) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	upstreamRemote, err := repo.FindUpstreamRemoteForPullRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	prNumber, err := upstreamRemote.ParsePullRequestID(ctx, arg)
+	if err != nil {
+		return err
+	}
+
+	if err := upstreamRemote.Fetch(ctx); err != nil {
+		return err
+	}
+
+	allBranches, err := upstreamRemote.ListBranches(ctx)
+	if err != nil {
+		return err
+	}
+	releasePatterns, err := repo.ReleaseBranchPatterns(ctx)
+	if err != nil {
+		return err
+	}
+	releaseBranches := releasePatterns.Filter(allBranches)
+	if len(releaseBranches) == 0 {
+		return fmt.Errorf("cannot determine any release branches matching %v", releasePatterns)
+	}
+
+	pr, err := upstreamRemote.GetPullRequest(ctx, prNumber)
+	if err != nil {
+		return err
+	}
+
+	landed, err := repo.FindLandedCommits(ctx, upstreamRemote, pr)
+	if err != nil {
+		return err
+	}
+	if landed.Method == git.MergeMethodUnmerged {
+		fmt.Printf("#%s %s has not been merged\n", prNumber, pr.Title())
+	} else {
+		fmt.Printf("#%s %s was merged into %s by %s\n", prNumber, pr.Title(), pr.BaseBranch(), landed.Method)
+	}
+	fmt.Printf("\n")
+
+	// We also look for the original commits, which may have been cherry-picked instead of what landed
+	if err := repo.FetchPullRequestCommits(ctx, upstreamRemote, pr); err != nil {
+		klog.Warningf("%v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "BRANCH\tSTATUS\tCOMMITS\n")
+	for _, branch := range releaseBranches {
+		status, commits, err := findInBranch(ctx, repo, pr, landed, branch)
+		if err != nil {
+			return fmt.Errorf("error checking branch %q: %w", branch.ShortName, err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", branch.ShortName, status, strings.Join(commits, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	backports, err := findBackports(ctx, upstreamRemote, pr)
+	if err != nil {
+		klog.Warningf("unable to list open backport pull requests: %v", err)
+	} else if len(backports) != 0 {
+		fmt.Printf("\nopen backports:\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, backport := range backports {
+			fmt.Fprintf(w, "  #%d\t%s\t%s\t%s\n", backport.Number, backport.BaseRefName, backport.Title, backport.URL)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findInBranch reports whether the landed commits are on the branch, and the matching commits on the branch.
+// The status is one of merged, cherry-picked, partial or missing.
+func findInBranch(ctx context.Context, repo *git.Repo, pr *git.GithubPullRequest, landed *git.LandedCommits, branch *git.Branch) (string, []string, error) {
+	if len(landed.SHAs) == 0 || !hasCommits(ctx, repo, landed.SHAs) {
+		return "missing", nil, nil
+	}
+
+	present, err := repo.FindPresentCommits(ctx, landed, branch.Name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var matches []string
+	ancestors := 0
+	for _, sha := range landed.SHAs {
+		targetSHA, found := present[sha]
+		if !found {
+			continue
+		}
+		if targetSHA == sha {
+			ancestors++
+		}
+		matches = append(matches, shortSHA(targetSHA))
+	}
+
+	switch {
+	case ancestors == len(landed.SHAs):
+		return "merged", matches, nil
+	case len(matches) == len(landed.SHAs):
+		return "cherry-picked", matches, nil
+	}
+
+	// The original (pre-squash) commits of the pull request may have been cherry-picked instead
+	if landed.Method != git.MergeMethodUnmerged && len(pr.Commits()) != 0 && hasCommits(ctx, repo, pr.Commits()) {
+		original := &git.LandedCommits{SHAs: pr.Commits()}
+		originalPresent, err := repo.FindPresentCommits(ctx, original, branch.Name)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(originalPresent) == len(original.SHAs) {
+			var originalMatches []string
+			for _, sha := range original.SHAs {
+				originalMatches = append(originalMatches, shortSHA(originalPresent[sha]))
+			}
+			return "cherry-picked", originalMatches, nil
+		}
+	}
+
+	if len(matches) != 0 {
+		return "partial", matches, nil
+	}
+	return "missing", nil, nil
+}
+
+// findBackports returns the open pull requests whose title references the pull request.
+func findBackports(ctx context.Context, remote *git.Remote, pr *git.GithubPullRequest) ([]*git.PullRequestStatus, error) {
+	number := fmt.Sprintf("%d", pr.Number())
+	candidates, err := remote.SearchOpenPullRequests(ctx, number+" in:title")
+	if err != nil {
+		return nil, err
+	}
+
+	// The search is fuzzy, so we check for the reference ourselves
+	reference := regexp.MustCompile(`#` + number + `\b`)
+	var backports []*git.PullRequestStatus
+	for _, candidate := range candidates {
+		if candidate.Number == pr.Number() {
+			continue
+		}
+		if reference.MatchString(candidate.Title) {
+			backports = append(backports, candidate)
+		}
+	}
+	return backports, nil
+}
+
+// hasCommits returns true if all the commits are present locally.
+func hasCommits(ctx context.Context, repo *git.Repo, shas []string) bool {
+	for _, sha := range shas {
+		if !repo.HasCommit(ctx, sha) {
+			klog.V(2).Infof("commit %s is not present locally", sha)
+			return false
+		}
+	}
+	return true
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
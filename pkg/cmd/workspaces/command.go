@@ -6,43 +6,118 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
 
 	"github.com/justinsb/gitflow/pkg/git"
 )
 
 func AddCommand(ctx context.Context, parent *cobra.Command) {
 	cmd := &cobra.Command{
-		Use:   "workspace",
+		Use:   "workspace [user:branch]",
 		Short: "Manage workspaces",
+		Long: `Manage workspaces, each of which is a git worktree for a branch.
+
+Workspaces are created under gitflow.workspace.root (default ~/workspaces), using the
+layout in gitflow.workspace.layout (default ` + defaultLayout + `).
+
+With a user:branch argument, the workspace is created if needed and its path is printed,
+so you can run: cd $(gitflow workspace user:branch)`,
 	}
 	var opt Options
 	opt.InitDefaults()
 
+	cmd.PersistentFlags().StringVar(&opt.Root, "root", opt.Root, "root directory for workspaces (overrides gitflow.workspace.root)")
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		return Run(cmd.Context(), opt, args)
 	}
+
+	addCreateCommand(ctx, cmd, &opt)
+	addListCommand(ctx, cmd, &opt)
+	addOpenCommand(ctx, cmd, &opt)
+	addRemoveCommand(ctx, cmd, &opt)
+
 	parent.AddCommand(cmd)
 }
 
 type Options struct {
+	// Root is the directory under which workspaces are created
+	Root string
 }
 
 func (o *Options) InitDefaults() {
 
 }
 
+// Run opens the workspace, creating it if it does not exist.
 func Run(ctx context.Context, opt Options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	return createOrOpen(ctx, opt, args[0], true)
+}
+
+func addCreateCommand(ctx context.Context, parent *cobra.Command, opt *Options) {
+	cmd := &cobra.Command{
+		Use:   "create <user:branch>",
+		Short: "Create a workspace for a branch from a contributor's fork",
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return createOrOpen(cmd.Context(), *opt, args[0], false)
+	}
+	parent.AddCommand(cmd)
+}
+
+func createOrOpen(ctx context.Context, opt Options, workspaceName string, allowExisting bool) error {
+	githubUser, githubBranch, err := parseWorkspaceName(workspaceName)
+	if err != nil {
+		return err
+	}
+
 	repo, err := git.OpenRepo(ctx)
 	if err != nil {
 		return err
 	}
 	defer repo.Close()
 
-	if len(args) != 1 {
-		return fmt.Errorf("expected 1 argument, got %d", len(args))
+	layout, err := loadLayout(ctx, repo, opt)
+	if err != nil {
+		return err
+	}
+
+	p, err := layout.PathFor(githubUser, githubBranch)
+	if err != nil {
+		return err
+	}
+
+	existing, err := layout.FindWorkspace(ctx, p)
+	if err != nil {
+		return err
 	}
-	workspaceName := args[0]
+	if existing != nil {
+		if !allowExisting {
+			return fmt.Errorf("workspace %q already exists at %q", workspaceName, p)
+		}
+	} else {
+		localBranchName, err := prepareBranch(ctx, repo, githubUser, githubBranch)
+		if err != nil {
+			return err
+		}
 
+		if err := repo.AddWorktree(ctx, p, &git.Branch{Name: localBranchName, ShortName: localBranchName}); err != nil {
+			return err
+		}
+	}
+
+	if err := markUsed(ctx, p); err != nil {
+		return err
+	}
+
+	fmt.Println(p)
+	return nil
+}
+
+func parseWorkspaceName(workspaceName string) (string, string, error) {
 	githubUser := ""
 	githubBranch := ""
 
@@ -52,15 +127,85 @@ func Run(ctx context.Context, opt Options, args []string) error {
 		githubBranch = tokens[1]
 	}
 	if githubUser == "" || githubBranch == "" {
-		return fmt.Errorf("workspace name must be in the format 'user:branch'")
+		return "", "", fmt.Errorf("workspace name must be in the format 'user:branch'")
 	}
+	return githubUser, githubBranch, nil
+}
 
-	branch := &git.Branch{
-		Name: githubBranch,
+// prepareBranch fetches the branch from the user's fork, and creates a local branch tracking it.
+// It returns the name of the local branch.
+func prepareBranch(ctx context.Context, repo *git.Repo, githubUser string, githubBranch string) (string, error) {
+	// Resolve our remotes before adding the contributor's remote, which could make them ambiguous
+	upstreamRemote, err := repo.FindUpstreamRemoteForPullRequests(ctx)
+	if err != nil {
+		return "", err
 	}
-	if err := repo.Checkout(ctx, branch); err != nil {
-		return err
+	forkRemote, err := repo.FindForkRemoteForPullRequests(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	// Prefer the pull request (if any), which tells us the fork and whether we can push to it
+	cloneURL := ""
+	canPush := false
+	prs, err := upstreamRemote.ListPullRequestsForBranch(ctx, githubUser, githubBranch, "open")
+	if err != nil {
+		return "", err
+	}
+	if len(prs) != 0 {
+		cloneURL = prs[0].HeadCloneURL()
+		canPush = prs[0].MaintainerCanModify()
+	}
+	if cloneURL == "" {
+		cloneURL, err = upstreamRemote.FindFork(ctx, githubUser)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	userRemote, err := repo.FindOrAddRemote(ctx, githubUser, cloneURL)
+	if err != nil {
+		return "", err
+	}
+
+	if err := userRemote.FetchBranch(ctx, githubBranch); err != nil {
+		return "", err
+	}
+	remoteBranch := &git.Branch{Name: userRemote.Name + "/" + githubBranch, ShortName: githubBranch, Remote: userRemote}
+
+	if forkRemote.Name == userRemote.Name {
+		// It's our own fork
+		canPush = true
+	}
+
+	localBranchName := githubBranch
+	if _, err := repo.RevParse(ctx, "refs/heads/"+localBranchName); err == nil {
+		tracking, err := repo.ExecGit(ctx, "rev-parse", "--abbrev-ref", localBranchName+"@{upstream}")
+		if err == nil && strings.TrimSpace(tracking.Stdout) == remoteBranch.Name {
+			return localBranchName, nil
+		}
+		// The name is taken by an unrelated branch
+		localBranchName = githubUser + "-" + githubBranch
+	}
+
+	if _, err := repo.RevParse(ctx, "refs/heads/"+localBranchName); err != nil {
+		if _, err := repo.CreateTrackingBranch(ctx, localBranchName, remoteBranch); err != nil {
+			return "", err
+		}
+	}
+
+	// Push back to the contributor's branch only if they allow it; otherwise pushes go to our fork
+	pushRemote := userRemote
+	if !canPush {
+		klog.Warningf("%s does not allow maintainers to push to %q; pushes will go to %q", githubUser, githubBranch, forkRemote.Name)
+		pushRemote = forkRemote
+	}
+	if err := repo.SetConfig(ctx, "branch."+localBranchName+".pushRemote", pushRemote.Name); err != nil {
+		return "", err
+	}
+	if localBranchName != githubBranch {
+		klog.Warningf("local branch %q has a different name from %q; push with 'git push %s HEAD:%s'", localBranchName, githubBranch, pushRemote.Name, githubBranch)
+	}
+
+	return localBranchName, nil
 }
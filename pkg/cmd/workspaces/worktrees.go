@@ -0,0 +1,366 @@
+package workspaces
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/justinsb/gitflow/pkg/git"
+)
+
+// defaultLayout is the default template for the path of a workspace
+const defaultLayout = "{{.Root}}/{{.Repo}}/{{.User}}-{{.Branch}}"
+
+// lastUsedFile is stored in the git dir of each workspace, recording when it was last opened
+const lastUsedFile = "gitflow-last-used"
+
+type layout struct {
+	repo *git.Repo
+
+	Root     string
+	RepoName string
+	Template *template.Template
+}
+
+func loadLayout(ctx context.Context, repo *git.Repo, opt Options) (*layout, error) {
+	config, err := repo.ListConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting repo config: %w", err)
+	}
+
+	root := opt.Root
+	if root == "" {
+		root = config.Get("gitflow.workspace.root")
+	}
+	if root == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine home directory (consider setting gitflow.workspace.root): %w", err)
+		}
+		root = filepath.Join(home, "workspaces")
+	}
+	if strings.HasPrefix(root, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine home directory: %w", err)
+		}
+		root = filepath.Join(home, strings.TrimPrefix(root, "~/"))
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve workspace root %q: %w", root, err)
+	}
+
+	layoutText := config.Get("gitflow.workspace.layout")
+	if layoutText == "" {
+		layoutText = defaultLayout
+	}
+	tmpl, err := template.New("layout").Option("missingkey=error").Parse(layoutText)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing gitflow.workspace.layout %q: %w", layoutText, err)
+	}
+
+	// Name workspaces after the upstream repository, falling back to the directory name
+	repoName := ""
+	if upstreamRemote, err := repo.FindUpstreamRemoteForPullRequests(ctx); err == nil {
+		if info, err := upstreamRemote.GithubInfo(ctx); err == nil {
+			repoName = info.Repository
+		}
+	}
+	if repoName == "" {
+		worktrees, err := repo.ListWorktrees(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(worktrees) == 0 {
+			return nil, fmt.Errorf("cannot determine main worktree")
+		}
+		repoName = filepath.Base(worktrees[0].Path)
+	}
+
+	return &layout{
+		repo:     repo,
+		Root:     root,
+		RepoName: repoName,
+		Template: tmpl,
+	}, nil
+}
+
+// PathFor returns the path to the workspace for the user's branch.
+func (l *layout) PathFor(user string, branch string) (string, error) {
+	data := map[string]string{
+		"Root":   l.Root,
+		"Repo":   l.RepoName,
+		"User":   user,
+		"Branch": strings.ReplaceAll(branch, "/", "-"),
+	}
+	var b bytes.Buffer
+	if err := l.Template.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error building workspace path: %w", err)
+	}
+	return filepath.Clean(b.String()), nil
+}
+
+// ListWorkspaces returns the worktrees under the workspace root.
+func (l *layout) ListWorkspaces(ctx context.Context) ([]*git.Worktree, error) {
+	worktrees, err := l.repo.ListWorktrees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaces []*git.Worktree
+	for _, worktree := range worktrees {
+		rel, err := filepath.Rel(l.Root, worktree.Path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		workspaces = append(workspaces, worktree)
+	}
+	return workspaces, nil
+}
+
+// FindWorkspace returns the workspace at path, or nil if there is no such workspace.
+func (l *layout) FindWorkspace(ctx context.Context, p string) (*git.Worktree, error) {
+	workspaces, err := l.ListWorkspaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, workspace := range workspaces {
+		if filepath.Clean(workspace.Path) == p {
+			return workspace, nil
+		}
+	}
+	return nil, nil
+}
+
+// resolveWorkspace maps a user:branch name or a path to a workspace.
+func resolveWorkspace(ctx context.Context, l *layout, arg string) (*git.Worktree, error) {
+	p := ""
+	if strings.Contains(arg, ":") {
+		user, branch, err := parseWorkspaceName(arg)
+		if err != nil {
+			return nil, err
+		}
+		p, err = l.PathFor(user, branch)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve path %q: %w", arg, err)
+		}
+		p = abs
+	}
+
+	workspace, err := l.FindWorkspace(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if workspace == nil {
+		return nil, fmt.Errorf("workspace %q not found (expected at %q)", arg, p)
+	}
+	return workspace, nil
+}
+
+func markUsed(ctx context.Context, p string) error {
+	workspaceRepo, err := git.OpenRepoAt(ctx, p)
+	if err != nil {
+		return err
+	}
+	gitDir, err := workspaceRepo.GitDir(ctx)
+	if err != nil {
+		return err
+	}
+	markerPath := filepath.Join(gitDir, lastUsedFile)
+	if err := os.WriteFile(markerPath, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return fmt.Errorf("error writing %q: %w", markerPath, err)
+	}
+	return nil
+}
+
+func lastUsed(ctx context.Context, workspaceRepo *git.Repo) (time.Time, error) {
+	gitDir, err := workspaceRepo.GitDir(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	b, err := os.ReadFile(filepath.Join(gitDir, lastUsedFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+}
+
+func addListCommand(ctx context.Context, parent *cobra.Command, opt *Options) {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List workspaces",
+		Args:  cobra.NoArgs,
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return RunList(cmd.Context(), *opt)
+	}
+	parent.AddCommand(cmd)
+}
+
+func RunList(ctx context.Context, opt Options) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	l, err := loadLayout(ctx, repo, opt)
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := l.ListWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "PATH\tBRANCH\tSTATE\tLAST USED\n")
+	for _, workspace := range workspaces {
+		branch := workspace.BranchName()
+		if branch == "" {
+			branch = "(detached)"
+		}
+
+		state := ""
+		used := ""
+		if workspace.Prunable != "" {
+			state = "missing"
+		} else {
+			workspaceRepo, err := git.OpenRepoAt(ctx, workspace.Path)
+			if err != nil {
+				return err
+			}
+			dirty, err := workspaceRepo.HasUncommittedChanges(ctx)
+			if err != nil {
+				return err
+			}
+			state = "clean"
+			if dirty {
+				state = "dirty"
+			}
+			t, err := lastUsed(ctx, workspaceRepo)
+			if err != nil {
+				return err
+			}
+			if !t.IsZero() {
+				used = t.Local().Format("2006-01-02 15:04")
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", workspace.Path, branch, state, used)
+	}
+	return w.Flush()
+}
+
+func addOpenCommand(ctx context.Context, parent *cobra.Command, opt *Options) {
+	cmd := &cobra.Command{
+		Use:   "open <user:branch|path>",
+		Short: "Print the path of a workspace, for use with cd",
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return RunOpen(cmd.Context(), *opt, args[0])
+	}
+	parent.AddCommand(cmd)
+}
+
+func RunOpen(ctx context.Context, opt Options, arg string) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	l, err := loadLayout(ctx, repo, opt)
+	if err != nil {
+		return err
+	}
+
+	workspace, err := resolveWorkspace(ctx, l, arg)
+	if err != nil {
+		return err
+	}
+
+	if err := markUsed(ctx, workspace.Path); err != nil {
+		return err
+	}
+	fmt.Println(workspace.Path)
+	return nil
+}
+
+type RemoveOptions struct {
+	// Force removes the workspace even if it has uncommitted changes
+	Force bool
+}
+
+func addRemoveCommand(ctx context.Context, parent *cobra.Command, opt *Options) {
+	cmd := &cobra.Command{
+		Use:   "remove <user:branch|path>",
+		Short: "Remove a workspace (the branch is kept)",
+		Args:  cobra.ExactArgs(1),
+	}
+	var removeOpt RemoveOptions
+	cmd.Flags().BoolVar(&removeOpt.Force, "force", removeOpt.Force, "remove even if the workspace has uncommitted changes")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return RunRemove(cmd.Context(), *opt, removeOpt, args[0])
+	}
+	parent.AddCommand(cmd)
+}
+
+func RunRemove(ctx context.Context, opt Options, removeOpt RemoveOptions, arg string) error {
+	repo, err := git.OpenRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	l, err := loadLayout(ctx, repo, opt)
+	if err != nil {
+		return err
+	}
+
+	workspace, err := resolveWorkspace(ctx, l, arg)
+	if err != nil {
+		return err
+	}
+
+	if workspace.Prunable == "" && !removeOpt.Force {
+		workspaceRepo, err := git.OpenRepoAt(ctx, workspace.Path)
+		if err != nil {
+			return err
+		}
+		dirty, err := workspaceRepo.HasUncommittedChanges(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("workspace %q has uncommitted changes; use --force to remove anyway", workspace.Path)
+		}
+	}
+
+	// When the directory is already gone, removing with --force cleans up just this worktree's metadata
+	// (unlike git worktree prune, which would clean up every stale worktree)
+	force := removeOpt.Force || workspace.Prunable != ""
+	if err := repo.RemoveWorktree(ctx, workspace.Path, force); err != nil {
+		return err
+	}
+	fmt.Printf("removed workspace %q\n", workspace.Path)
+	return nil
+}
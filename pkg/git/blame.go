@@ -0,0 +1,44 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// BlameLines returns the sha of the commit that last changed each line from start to end (inclusive) of the file at rev.
+func (r *Repo) BlameLines(ctx context.Context, rev string, p string, start, end int) ([]string, error) {
+	result, err := r.ExecGit(ctx, "blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end), rev, "--", p)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	// Each line of the file is preceded by a header line "<sha> <orig-line> <final-line> [<count>]",
+	// and possibly commit information, and is itself prefixed with a tab.
+	var shas []string
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if line == "" || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		tokens := strings.Fields(line)
+		if len(tokens) >= 3 && isHexSHA(tokens[0]) {
+			shas = append(shas, tokens[0])
+		}
+	}
+	return shas, nil
+}
+
+func isHexSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,11 @@
 package git
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type Branch struct {
 	Name      string
@@ -22,3 +27,170 @@ func (r *Repo) DeleteBranch(ctx context.Context, branchName string) error {
 	}
 	return nil
 }
+
+// ListLocalBranches returns the local branches, most recently committed first.
+func (r *Repo) ListLocalBranches(ctx context.Context) ([]*Branch, error) {
+	result, err := r.ExecGit(ctx, "for-each-ref", "--sort=-committerdate", "--format=%(refname:short)", "refs/heads")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	var branches []*Branch
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		branches = append(branches, &Branch{Name: name, ShortName: name})
+	}
+	return branches, nil
+}
+
+// BranchUpstream is the branch that a local branch tracks
+type BranchUpstream struct {
+	// Upstream is the short name of the tracked branch, e.g. origin/main
+	Upstream string
+
+	// Gone is true if the tracked branch no longer exists
+	Gone bool
+}
+
+// ListBranchUpstreams returns the tracked branch for each local branch that has one.
+func (r *Repo) ListBranchUpstreams(ctx context.Context) (map[string]*BranchUpstream, error) {
+	result, err := r.ExecGit(ctx, "for-each-ref", "--format=%(refname:short)%00%(upstream:short)%00%(upstream:track)", "refs/heads")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	upstreams := make(map[string]*BranchUpstream)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if line == "" {
+			continue
+		}
+		tokens := strings.Split(line, "\x00")
+		if len(tokens) != 3 {
+			return nil, fmt.Errorf("cannot parse for-each-ref line %q", line)
+		}
+		if tokens[1] == "" {
+			continue
+		}
+		upstreams[tokens[0]] = &BranchUpstream{Upstream: tokens[1], Gone: tokens[2] == "[gone]"}
+	}
+	return upstreams, nil
+}
+
+// UpdateRef points the ref at the revision, recording message in the reflog.
+// The reflog is created if needed, even for refs outside refs/heads, so earlier values can be recovered.
+func (r *Repo) UpdateRef(ctx context.Context, ref string, rev string, message string) error {
+	result, err := r.ExecGit(ctx, "update-ref", "--create-reflog", "-m", message, ref, rev)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return err
+	}
+	return nil
+}
+
+func branchParentKey(branchName string) string {
+	return "branch." + branchName + ".gitflow-parent"
+}
+
+// GetBranchParent returns the local branch that the branch is stacked on, or "" if not set.
+func (r *Repo) GetBranchParent(ctx context.Context, branchName string) (string, error) {
+	config, err := r.ListConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error getting repo config: %w", err)
+	}
+	return config.Get(branchParentKey(branchName)), nil
+}
+
+// SetBranchParent records that the branch is stacked on the parent branch; an empty parent clears the relation.
+func (r *Repo) SetBranchParent(ctx context.Context, branchName string, parent string) error {
+	if parent == "" {
+		return r.UnsetConfig(ctx, branchParentKey(branchName))
+	}
+	return r.SetConfig(ctx, branchParentKey(branchName), parent)
+}
+
+// ListBranchParents returns the recorded parent for every branch that has one, keyed by branch name.
+func (r *Repo) ListBranchParents(ctx context.Context) (map[string]string, error) {
+	config, err := r.ListConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting repo config: %w", err)
+	}
+
+	parents := make(map[string]string)
+	for _, k := range config.Keys("branch.") {
+		if !strings.HasSuffix(k, ".gitflow-parent") {
+			continue
+		}
+		branchName := strings.TrimSuffix(strings.TrimPrefix(k, "branch."), ".gitflow-parent")
+		parents[branchName] = config.Get(k)
+	}
+	return parents, nil
+}
+
+func branchPullRequestKey(branchName string) string {
+	return "branch." + branchName + ".gitflow-pr"
+}
+
+// GetBranchPullRequest returns the pull request number recorded for the branch, or "" if not set.
+func (r *Repo) GetBranchPullRequest(ctx context.Context, branchName string) (string, error) {
+	config, err := r.ListConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error getting repo config: %w", err)
+	}
+	return config.Get(branchPullRequestKey(branchName)), nil
+}
+
+// SetBranchPullRequest records the pull request number for the branch.
+func (r *Repo) SetBranchPullRequest(ctx context.Context, branchName string, prNumber string) error {
+	return r.SetConfig(ctx, branchPullRequestKey(branchName), prNumber)
+}
+
+// MergeBase returns the best common ancestor of the two revisions.
+func (r *Repo) MergeBase(ctx context.Context, a, b string) (string, error) {
+	result, err := r.ExecGit(ctx, "merge-base", a, b)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// ForkPoint returns the point at which commit forked from ref, using the reflog of ref;
+// this finds the right base even if ref has since been rewritten.
+func (r *Repo) ForkPoint(ctx context.Context, ref, commit string) (string, error) {
+	result, err := r.ExecGit(ctx, "merge-base", "--fork-point", ref, commit)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// AheadBehind returns the number of commits in branch but not in base (ahead), and in base but not in branch (behind).
+func (r *Repo) AheadBehind(ctx context.Context, base, branch string) (int, int, error) {
+	result, err := r.ExecGit(ctx, "rev-list", "--left-right", "--count", base+"..."+branch)
+	if err != nil {
+		return 0, 0, err
+	}
+	tokens := strings.Fields(result.Stdout)
+	if len(tokens) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", result.Stdout)
+	}
+	behind, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", result.Stdout)
+	}
+	ahead, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", result.Stdout)
+	}
+	return ahead, behind, nil
+}
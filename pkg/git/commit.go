@@ -0,0 +1,108 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Commit struct {
+	SHA     string
+	Subject string
+	Body    string
+}
+
+func (c *Commit) String() string {
+	return c.SHA
+}
+
+// ShortSHA returns an abbreviated form of the sha, suitable for display.
+func (c *Commit) ShortSHA() string {
+	if len(c.SHA) > 12 {
+		return c.SHA[:12]
+	}
+	return c.SHA
+}
+
+// Trailer returns the values of the trailer with the given key (e.g. "Signed-off-by"), matched case-insensitively.
+func (c *Commit) Trailer(key string) []string {
+	var values []string
+	for _, line := range strings.Split(c.Body, "\n") {
+		tokens := strings.SplitN(line, ":", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(tokens[0]), key) {
+			values = append(values, strings.TrimSpace(tokens[1]))
+		}
+	}
+	return values
+}
+
+// HasCommit returns true if the commit exists in the local repository.
+func (r *Repo) HasCommit(ctx context.Context, sha string) bool {
+	_, err := r.ExecGit(ctx, "cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+// ListCommits returns the commits matching the git log arguments (typically a range), oldest first.
+func (r *Repo) ListCommits(ctx context.Context, logArgs ...string) ([]*Commit, error) {
+	args := []string{"log", "--reverse", "-z", "--format=%H%x1f%s%x1f%b"}
+	args = append(args, logArgs...)
+	args = append(args, "--")
+	result, err := r.ExecGit(ctx, args...)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	var commits []*Commit
+	for _, record := range strings.Split(result.Stdout, "\x00") {
+		record = strings.TrimPrefix(record, "\n")
+		if record == "" {
+			continue
+		}
+		tokens := strings.SplitN(record, "\x1f", 3)
+		if len(tokens) != 3 {
+			return nil, fmt.Errorf("error parsing log record %q (expected 3 fields)", record)
+		}
+		commits = append(commits, &Commit{
+			SHA:     tokens[0],
+			Subject: tokens[1],
+			Body:    strings.TrimSpace(tokens[2]),
+		})
+	}
+	return commits, nil
+}
+
+var cherryPickedFromRegex = regexp.MustCompile(`\(cherry picked from commit ([0-9a-f]+)\)`)
+
+// CherryPickedFrom returns the source shas recorded by cherry-pick -x in the commit message.
+func (c *Commit) CherryPickedFrom() []string {
+	var shas []string
+	for _, match := range cherryPickedFromRegex.FindAllStringSubmatch(c.Body, -1) {
+		shas = append(shas, match[1])
+	}
+	return shas
+}
+
+// CommitTime returns the committer time of the commit.
+func (r *Repo) CommitTime(ctx context.Context, rev string) (time.Time, error) {
+	result, err := r.ExecGit(ctx, "log", "-1", "--format=%ct", rev, "--")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse commit time %q: %w", result.Stdout, err)
+	}
+	return time.Unix(seconds, 0), nil
+}
@@ -50,3 +50,19 @@ func (c *Config) Get(k string) string {
 	values := c.values[k]
 	return strings.Join(values, ",")
 }
+
+// GetAll returns all the values of the key
+func (c *Config) GetAll(k string) []string {
+	return c.values[k]
+}
+
+// Keys returns all the keys with the given prefix
+func (c *Config) Keys(prefix string) []string {
+	var keys []string
+	for k := range c.values {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,255 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HunkRange is the position of a hunk, parsed from a "@@ -a,b +c,d @@" header
+type HunkRange struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ParseHunkHeader parses a unified diff hunk header line.
+func ParseHunkHeader(line string) (HunkRange, error) {
+	match := hunkHeaderRegex.FindStringSubmatch(line)
+	if match == nil {
+		return HunkRange{}, fmt.Errorf("cannot parse hunk header %q", line)
+	}
+
+	// A missing count means 1
+	atoi := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return HunkRange{
+		OldStart: atoi(match[1]),
+		OldLines: atoi(match[2]),
+		NewStart: atoi(match[3]),
+		NewLines: atoi(match[4]),
+	}, nil
+}
+
+// Hunk is one hunk of a unified diff, along with the header of its file so it can be applied on its own.
+type Hunk struct {
+	// Header is the file header: the diff --git line through the +++ line
+	Header string
+
+	// Content is the @@ line and the lines of the hunk
+	Content string
+
+	// Range is the position of the hunk, parsed from the @@ line
+	Range HunkRange
+}
+
+// OldPath returns the path of the file before the change, or "" for a new file.
+func (h *Hunk) OldPath() string {
+	for _, line := range strings.Split(h.Header, "\n") {
+		if strings.HasPrefix(line, "--- ") {
+			return parseDiffPath(strings.TrimPrefix(line, "--- "), "a/")
+		}
+	}
+	return ""
+}
+
+// NewPath returns the path of the file after the change, or "" for a deleted file.
+func (h *Hunk) NewPath() string {
+	for _, line := range strings.Split(h.Header, "\n") {
+		if strings.HasPrefix(line, "+++ ") {
+			return parseDiffPath(strings.TrimPrefix(line, "+++ "), "b/")
+		}
+	}
+	return ""
+}
+
+// parseDiffPath returns the path from a ---/+++ line of a diff, or "" for /dev/null.
+// Git appends a tab to paths containing spaces, and quotes paths with unusual characters (as in C).
+func parseDiffPath(p string, prefix string) string {
+	p = strings.TrimSuffix(p, "\t")
+	if strings.HasPrefix(p, `"`) {
+		if unquoted, err := strconv.Unquote(p); err == nil {
+			p = unquoted
+		}
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+// Location returns the file and line range of the hunk, for reporting.
+func (h *Hunk) Location() string {
+	p := h.OldPath()
+	if p == "" {
+		p = h.NewPath()
+	}
+	r := h.Range
+	if r.OldLines == 0 {
+		return fmt.Sprintf("%s:+%d", p, r.OldStart)
+	}
+	return fmt.Sprintf("%s:%d-%d", p, r.OldStart, r.OldStart+r.OldLines-1)
+}
+
+// SelectHunksByPattern returns the hunks whose content (including removed lines) matches the regex.
+func SelectHunksByPattern(hunks []*Hunk, re *regexp.Regexp) []*Hunk {
+	var selected []*Hunk
+	for _, h := range hunks {
+		if re.MatchString(h.Content) {
+			selected = append(selected, h)
+		}
+	}
+	return selected
+}
+
+// SelectHunksByPath returns the hunks of files matching the glob.
+// The glob can match the whole path, or one of its directories.
+func SelectHunksByPath(hunks []*Hunk, glob string) ([]*Hunk, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid path glob %q: %w", glob, err)
+	}
+	matches := func(p string) bool {
+		for p != "" && p != "." {
+			if match, _ := path.Match(glob, p); match {
+				return true
+			}
+			p = path.Dir(p)
+		}
+		return false
+	}
+
+	var selected []*Hunk
+	for _, h := range hunks {
+		if matches(h.OldPath()) || matches(h.NewPath()) {
+			selected = append(selected, h)
+		}
+	}
+	return selected, nil
+}
+
+// ParseDiff splits a unified diff into hunks.  Files without hunks (for example binary files) are skipped.
+func ParseDiff(r io.Reader) ([]*Hunk, error) {
+	var hunks []*Hunk
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var current *Hunk
+	var headerLines []string
+	inHeader := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "diff --git") {
+			// New file
+			headerLines = []string{line}
+			inHeader = true
+			current = nil
+		} else if strings.HasPrefix(line, "@@") {
+			inHeader = false
+			hunkRange, err := ParseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			current = &Hunk{
+				Header:  strings.Join(headerLines, "\n") + "\n",
+				Content: line + "\n",
+				Range:   hunkRange,
+			}
+			hunks = append(hunks, current)
+		} else if inHeader {
+			headerLines = append(headerLines, line)
+		} else if current != nil {
+			// It's a content line (+, - or context)
+			current.Content += line + "\n"
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading diff: %w", err)
+	}
+	return hunks, nil
+}
+
+// HunkApplier applies subsets of the hunks of a zero-context diff (diff -U0) to the index, one subset at a time.
+// Line numbers are adjusted for the hunks that have already been applied, and for those that have not.
+type HunkApplier struct {
+	repo    *Repo
+	hunks   []*Hunk
+	applied map[*Hunk]bool
+}
+
+// NewHunkApplier returns a HunkApplier for the hunks, which must all come from one diff -U0, in order.
+func (r *Repo) NewHunkApplier(hunks []*Hunk) *HunkApplier {
+	return &HunkApplier{repo: r, hunks: hunks, applied: make(map[*Hunk]bool)}
+}
+
+// ApplyToIndex applies the subset of hunks to the index.
+// The index must contain the original (pre-image) files, plus the hunks applied by earlier calls.
+func (a *HunkApplier) ApplyToIndex(ctx context.Context, subset []*Hunk) error {
+	selected := make(map[*Hunk]bool)
+	selectedFiles := make(map[string]bool)
+	for _, h := range subset {
+		selected[h] = true
+		selectedFiles[h.Header] = true
+	}
+
+	var patch bytes.Buffer
+	// Each hunk moves the lines after it by this much, once applied
+	delta := func(h *Hunk) int { return h.Range.NewLines - h.Range.OldLines }
+
+	appliedBefore, pendingBefore := 0, 0
+	lastHeader := ""
+	for _, h := range a.hunks {
+		if h.Header != lastHeader {
+			appliedBefore, pendingBefore = 0, 0
+			lastHeader = h.Header
+			if selectedFiles[h.Header] {
+				patch.WriteString(h.Header)
+			}
+		}
+
+		if selected[h] {
+			r := h.Range
+			// The old side is the index, which has the earlier applied hunks;
+			// the new side additionally has the earlier hunks in this patch, but not the pending ones.
+			oldStart := r.OldStart + appliedBefore
+			newStart := r.NewStart - pendingBefore
+			body := h.Content[strings.Index(h.Content, "\n")+1:]
+			fmt.Fprintf(&patch, "@@ -%d,%d +%d,%d @@\n", oldStart, r.OldLines, newStart, r.NewLines)
+			patch.WriteString(body)
+		}
+
+		switch {
+		case a.applied[h]:
+			appliedBefore += delta(h)
+		case !selected[h]:
+			pendingBefore += delta(h)
+		}
+	}
+
+	result, err := a.repo.ExecGitWithInput(ctx, patch.String(), "apply", "--cached", "--unidiff-zero", "-")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return fmt.Errorf("error applying hunks to index: %w", err)
+	}
+	for _, h := range subset {
+		a.applied[h] = true
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// EditFile opens the file in the user's configured git editor, waiting for the editor to exit.
+func (r *Repo) EditFile(ctx context.Context, p string) error {
+	result, err := r.ExecGit(ctx, "var", "GIT_EDITOR")
+	if err != nil {
+		return err
+	}
+	editor := strings.TrimSpace(result.Stdout)
+	if editor == "" {
+		return fmt.Errorf("cannot determine editor (set GIT_EDITOR or core.editor)")
+	}
+
+	// The editor is a shell snippet (e.g. "code --wait"), so we run it the same way git does
+	cmd := exec.CommandContext(ctx, "sh", "-c", editor+` "$@"`, editor, p)
+	cmd.Dir = r.Dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	klog.V(1).Infof("running %s", strings.Join(cmd.Args, " "))
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running editor %q: %w", editor, err)
+	}
+	return nil
+}
+
+// GitDir returns the path to the .git directory (which may not be under Dir, for worktrees).
+func (r *Repo) GitDir(ctx context.Context) (string, error) {
+	result, err := r.ExecGit(ctx, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
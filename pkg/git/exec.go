@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -25,9 +26,14 @@ func (r *ExecResult) PrintOutput() {
 }
 
 func execGit(ctx context.Context, dir string, args ...string) (*ExecResult, error) {
+	return execGitWithInput(ctx, dir, nil, args...)
+}
+
+func execGitWithInput(ctx context.Context, dir string, stdin io.Reader, args ...string) (*ExecResult, error) {
 	cmd := exec.CommandContext(ctx, "git", args...)
 
 	cmd.Dir = dir
+	cmd.Stdin = stdin
 
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
@@ -55,6 +61,11 @@ func execGit(ctx context.Context, dir string, args ...string) (*ExecResult, erro
 }
 
 func execGitInteractive(ctx context.Context, dir string, args ...string) (*ExecResult, error) {
+	return execGitInteractiveWithEnv(ctx, dir, nil, args...)
+}
+
+// execGitInteractiveWithEnv is execGitInteractive, with additional environment variables (KEY=VALUE).
+func execGitInteractiveWithEnv(ctx context.Context, dir string, env []string, args ...string) (*ExecResult, error) {
 	// fullPath, err := exec.LookPath("git")
 	// if err != nil {
 	// 	return nil, fmt.Errorf("unable to find git in path: %w", err)
@@ -92,6 +103,9 @@ func execGitInteractive(ctx context.Context, dir string, args ...string) (*ExecR
 	cmd := exec.CommandContext(ctx, "git", args...)
 
 	cmd.Dir = dir
+	if len(env) != 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -0,0 +1,120 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MergeMethod is how a pull request was merged upstream
+type MergeMethod string
+
+const (
+	MergeMethodMerge    MergeMethod = "merge"
+	MergeMethodSquash   MergeMethod = "squash"
+	MergeMethodRebase   MergeMethod = "rebase"
+	MergeMethodUnmerged MergeMethod = "unmerged"
+)
+
+// LandedCommits describes the commits with which a pull request landed upstream
+type LandedCommits struct {
+	Method MergeMethod
+
+	// SHAs are the commits to cherry-pick, oldest first
+	SHAs []string
+
+	// Mainline is the parent number to pass to cherry-pick -m, when picking a merge commit
+	Mainline int
+}
+
+// FindLandedCommits determines how the pull request was merged, and the commits that landed.
+// The commits are fetched from remote if they are not already present.
+// For unmerged pull requests, we return the original commits of the pull request.
+func (r *Repo) FindLandedCommits(ctx context.Context, remote *Remote, pr *GithubPullRequest) (*LandedCommits, error) {
+	mergeSHA := pr.MergeCommitSHA()
+	if !pr.Merged() || mergeSHA == "" {
+		if err := r.FetchPullRequestCommits(ctx, remote, pr); err != nil {
+			return nil, err
+		}
+		return &LandedCommits{Method: MergeMethodUnmerged, SHAs: pr.Commits()}, nil
+	}
+
+	if _, err := r.RevParse(ctx, mergeSHA); err != nil {
+		// GitHub allows fetching reachable commits by sha
+		if _, err := r.ExecGit(ctx, "fetch", remote.Name, mergeSHA); err != nil {
+			return nil, fmt.Errorf("unable to fetch merge commit %s: %w", mergeSHA, err)
+		}
+	}
+
+	parents, err := r.CommitParents(ctx, mergeSHA)
+	if err != nil {
+		return nil, err
+	}
+	if len(parents) > 1 {
+		return &LandedCommits{Method: MergeMethodMerge, SHAs: []string{mergeSHA}, Mainline: 1}, nil
+	}
+
+	// A rebase-merge lands a copy of each commit, ending with the merge commit sha;
+	// we recognize it by matching the subjects.  Otherwise it was a squash.
+	prSubjects := pr.CommitSubjects()
+	if len(prSubjects) > 1 {
+		landed, err := r.ListCommits(ctx, "-n", strconv.Itoa(len(prSubjects)), mergeSHA)
+		if err != nil {
+			return nil, err
+		}
+		if len(landed) == len(prSubjects) {
+			isRebase := true
+			var shas []string
+			for i, commit := range landed {
+				if commit.Subject != prSubjects[i] {
+					isRebase = false
+					break
+				}
+				shas = append(shas, commit.SHA)
+			}
+			if isRebase {
+				return &LandedCommits{Method: MergeMethodRebase, SHAs: shas}, nil
+			}
+		}
+	}
+
+	return &LandedCommits{Method: MergeMethodSquash, SHAs: []string{mergeSHA}}, nil
+}
+
+// CommitParents returns the parent shas of the commit.
+func (r *Repo) CommitParents(ctx context.Context, sha string) ([]string, error) {
+	result, err := r.ExecGit(ctx, "rev-list", "--parents", "-n", "1", sha)
+	if err != nil {
+		return nil, err
+	}
+	tokens := strings.Fields(result.Stdout)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("commit %q not found", sha)
+	}
+	return tokens[1:], nil
+}
+
+// FetchPullRequestCommits fetches the original commits of the pull request, if they are not already present.
+// They are normally only reachable from refs/pull/<number>/head, which is not part of the default fetch.
+func (r *Repo) FetchPullRequestCommits(ctx context.Context, remote *Remote, pr *GithubPullRequest) error {
+	missing := false
+	for _, sha := range pr.Commits() {
+		if !r.HasCommit(ctx, sha) {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	ref := fmt.Sprintf("pull/%d/head", pr.Number())
+	if result, err := r.ExecGit(ctx, "fetch", "--quiet", remote.Name, ref); err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return fmt.Errorf("unable to fetch the commits of pull request #%d: %w", pr.Number(), err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// IsSquashMerged returns true if the combined changes of branch (since it forked from target)
+// are present on target as a single commit, as when the branch was squash-merged.
+func (r *Repo) IsSquashMerged(ctx context.Context, target, branch string) (bool, error) {
+	mergeBase, err := r.MergeBase(ctx, target, branch)
+	if err != nil {
+		return false, err
+	}
+
+	// Build a synthetic commit with the combined changes, and ask git cherry if target has an equivalent.
+	// The identity doesn't matter (only the diff does), but we supply one in case the user has not configured one.
+	result, err := r.ExecGit(ctx, "-c", "user.name=gitflow", "-c", "user.email=gitflow@localhost", "commit-tree", branch+"^{tree}", "-p", mergeBase, "-m", "squash of "+branch)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return false, err
+	}
+	squashed := strings.TrimSpace(result.Stdout)
+
+	cherry, err := r.cherry(ctx, target, squashed)
+	if err != nil {
+		return false, err
+	}
+	return len(cherry) == 1 && cherry[0].Present, nil
+}
+
+// IsRebaseMerged returns true if every commit on branch (since it forked from target)
+// has an equivalent commit on target, as when the branch was rebase-merged.
+func (r *Repo) IsRebaseMerged(ctx context.Context, target, branch string) (bool, error) {
+	cherry, err := r.cherry(ctx, target, branch)
+	if err != nil {
+		return false, err
+	}
+	if len(cherry) == 0 {
+		return false, nil
+	}
+	for _, commit := range cherry {
+		if !commit.Present {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// cherryCommit is a line of git cherry output
+type cherryCommit struct {
+	SHA string
+
+	// Present is true if an equivalent commit exists upstream
+	Present bool
+}
+
+// cherry runs git cherry, returning the commits on head (but not upstream) and whether they have an equivalent on upstream.
+func (r *Repo) cherry(ctx context.Context, upstream, head string) ([]cherryCommit, error) {
+	result, err := r.ExecGit(ctx, "cherry", upstream, head)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	var commits []cherryCommit
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		tokens := strings.Fields(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		if len(tokens) != 2 || (tokens[0] != "+" && tokens[0] != "-") {
+			return nil, fmt.Errorf("cannot interpret git cherry line %q", line)
+		}
+		commits = append(commits, cherryCommit{SHA: tokens[1], Present: tokens[0] == "-"})
+	}
+	return commits, nil
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PatchIDs returns the stable patch-ids of the non-merge commits matching the git log arguments (typically a range).
+// The result maps each patch-id to the sha of the commit.
+func (r *Repo) PatchIDs(ctx context.Context, logArgs ...string) (map[string]string, error) {
+	args := []string{"log", "-p", "--no-merges", "--no-color"}
+	args = append(args, logArgs...)
+	args = append(args, "--")
+	diff, err := r.ExecGit(ctx, args...)
+	if err != nil {
+		if diff.ExitCode != 0 {
+			diff.PrintOutput()
+		}
+		return nil, err
+	}
+
+	return r.parsePatchIDs(ctx, diff.Stdout)
+}
+
+// CommitPatchID returns the stable patch-id of the commit's changes, or "" if the commit has no changes.
+// For merge commits, mainline selects the parent to diff against.
+func (r *Repo) CommitPatchID(ctx context.Context, sha string, mainline int) (string, error) {
+	args := []string{"diff-tree", "-p", "--no-color"}
+	if mainline != 0 {
+		args = append(args, sha+"^"+strconv.Itoa(mainline))
+	}
+	args = append(args, sha, "--")
+	diff, err := r.ExecGit(ctx, args...)
+	if err != nil {
+		if diff.ExitCode != 0 {
+			diff.PrintOutput()
+		}
+		return "", err
+	}
+
+	patchIDs, err := r.parsePatchIDs(ctx, diff.Stdout)
+	if err != nil {
+		return "", err
+	}
+	for patchID := range patchIDs {
+		return patchID, nil
+	}
+	return "", nil
+}
+
+func (r *Repo) parsePatchIDs(ctx context.Context, diff string) (map[string]string, error) {
+	result, err := r.ExecGitWithInput(ctx, diff, "patch-id", "--stable")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	patchIDs := make(map[string]string)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		tokens := strings.Fields(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("unexpected patch-id output %q", line)
+		}
+		patchIDs[tokens[0]] = tokens[1]
+	}
+	return patchIDs, nil
+}
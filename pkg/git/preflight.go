@@ -0,0 +1,168 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// PreflightOptions controls the checks made before commands that switch branches or rewrite history.
+type PreflightOptions struct {
+	// Autostash, if set, overrides the gitflow.autostash setting.
+	// With autostash, uncommitted changes are stashed and restored afterwards, rather than refusing to run.
+	Autostash *bool
+}
+
+// Preflight is a successful preflight check; Restore should be called when the command is done.
+type Preflight struct {
+	repo    *Repo
+	stashed bool
+
+	// branch is the branch that was checked out, where we restore any stashed changes
+	branch string
+}
+
+// inProgressMarkers are the files git creates in the git dir while an operation is stopped part way through
+var inProgressMarkers = []struct {
+	Path      string
+	Operation string
+}{
+	{"rebase-merge", "rebase"},
+	{"rebase-apply", "rebase"},
+	{"CHERRY_PICK_HEAD", "cherry-pick"},
+	{"REVERT_HEAD", "revert"},
+	{"MERGE_HEAD", "merge"},
+	{"BISECT_LOG", "bisect"},
+}
+
+// InProgressOperation returns the operation (rebase, cherry-pick, revert, merge or bisect) that is in progress, or "".
+func (r *Repo) InProgressOperation(ctx context.Context) (string, error) {
+	for _, marker := range inProgressMarkers {
+		// --git-path resolves correctly for linked worktrees
+		result, err := r.ExecGit(ctx, "rev-parse", "--git-path", marker.Path)
+		if err != nil {
+			return "", err
+		}
+		p := strings.TrimSpace(result.Stdout)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(r.Dir, p)
+		}
+		if _, err := os.Stat(p); err == nil {
+			return marker.Operation, nil
+		}
+	}
+	return "", nil
+}
+
+// RecoveryHint returns the commands that finish or abort an in-progress operation, for error messages.
+func RecoveryHint(operation string) string {
+	if operation == "bisect" {
+		return "git bisect reset"
+	}
+	return fmt.Sprintf("git %s --continue or git %s --abort", operation, operation)
+}
+
+// HasTrackedChanges returns true if tracked files have uncommitted changes, in the working tree or the index.
+func (r *Repo) HasTrackedChanges(ctx context.Context) (bool, error) {
+	result, err := r.ExecGit(ctx, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(result.Stdout) != "", nil
+}
+
+// Preflight checks that we can switch branches: that no operation is in progress, HEAD is not detached,
+// and there are no uncommitted changes.  Uncommitted changes are stashed if autostash is enabled,
+// otherwise we refuse with an error.
+func (r *Repo) Preflight(ctx context.Context, opt PreflightOptions) (*Preflight, error) {
+	operation, err := r.InProgressOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if operation != "" {
+		return nil, fmt.Errorf("a %s is in progress; finish or abort it first (%s)", operation, RecoveryHint(operation))
+	}
+
+	head, err := r.ExecGit(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("HEAD is detached; check out a branch first")
+	}
+	branch := strings.TrimSpace(head.Stdout)
+
+	dirty, err := r.HasTrackedChanges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !dirty {
+		return &Preflight{repo: r, branch: branch}, nil
+	}
+
+	autostash := false
+	if opt.Autostash != nil {
+		autostash = *opt.Autostash
+	} else {
+		config, err := r.ListConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting repo config: %w", err)
+		}
+		autostash = config.Get("gitflow.autostash") == "true"
+	}
+	if !autostash {
+		return nil, fmt.Errorf("you have uncommitted changes; commit or stash them first, or use --autostash (or set gitflow.autostash=true)")
+	}
+
+	result, err := r.ExecGit(ctx, "stash", "push", "--message", "gitflow autostash")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, fmt.Errorf("error stashing uncommitted changes: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "stashed uncommitted changes\n")
+	return &Preflight{repo: r, stashed: true, branch: branch}, nil
+}
+
+// Restore restores any stashed changes, on the branch that was checked out at preflight.
+// If an operation has stopped part way (for example on a conflict), or the changes don't apply cleanly,
+// they are left in the stash and we tell the user.
+func (p *Preflight) Restore(ctx context.Context) {
+	if !p.stashed {
+		return
+	}
+
+	operation, err := p.repo.InProgressOperation(ctx)
+	if err != nil {
+		klog.Warningf("error checking for in-progress operations: %v", err)
+	}
+	if operation != "" {
+		fmt.Fprintf(os.Stderr, "your uncommitted changes are in the stash; run 'git stash pop' once the %s is finished\n", operation)
+		return
+	}
+
+	// The command may have stopped on another branch (for example after a failed push); the changes belong on the original
+	head, err := p.repo.ExecGit(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil || strings.TrimSpace(head.Stdout) != p.branch {
+		if result, err := p.repo.ExecGit(ctx, "checkout", "--quiet", p.branch); err != nil {
+			if result.ExitCode != 0 {
+				result.PrintOutput()
+			}
+			fmt.Fprintf(os.Stderr, "your uncommitted changes are in the stash; run 'git stash pop' after switching back to %s\n", p.branch)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "switched back to %s\n", p.branch)
+	}
+
+	result, err := p.repo.ExecGit(ctx, "stash", "pop")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		fmt.Fprintf(os.Stderr, "your uncommitted changes could not be restored cleanly; they remain in the stash (git stash list)\n")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "restored uncommitted changes\n")
+}
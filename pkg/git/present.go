@@ -0,0 +1,82 @@
+package git
+
+import (
+	"context"
+
+	"k8s.io/klog/v2"
+)
+
+// FindCherryPicks returns the commits matching the git log arguments (typically a range) that were made by cherry-pick -x.
+// The result maps each source sha to the sha of the cherry-picked commit.
+func (r *Repo) FindCherryPicks(ctx context.Context, logArgs ...string) (map[string]string, error) {
+	args := []string{"--fixed-strings", "--grep", "(cherry picked from commit "}
+	args = append(args, logArgs...)
+	commits, err := r.ListCommits(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	cherryPicks := make(map[string]string)
+	for _, commit := range commits {
+		for _, from := range commit.CherryPickedFrom() {
+			cherryPicks[from] = commit.SHA
+		}
+	}
+	return cherryPicks, nil
+}
+
+// FindPresentCommits returns the landed commits that are already on the target branch,
+// either because they are ancestors of the target, or because an equivalent change was cherry-picked:
+// a commit with the same patch-id, or one that records the sha with cherry-pick -x.
+// The result maps each present sha to the matching commit on the target.
+func (r *Repo) FindPresentCommits(ctx context.Context, landed *LandedCommits, target string) (map[string]string, error) {
+	present := make(map[string]string)
+
+	var candidates []string
+	for _, sha := range landed.SHAs {
+		if _, err := r.ExecGit(ctx, "merge-base", "--is-ancestor", sha, target); err == nil {
+			present[sha] = sha
+		} else {
+			candidates = append(candidates, sha)
+		}
+	}
+	if len(candidates) == 0 {
+		return present, nil
+	}
+
+	mergeBase, err := r.MergeBase(ctx, candidates[len(candidates)-1], target)
+	if err != nil {
+		return nil, err
+	}
+	targetRange := mergeBase + ".." + target
+
+	targetPatchIDs, err := r.PatchIDs(ctx, targetRange)
+	if err != nil {
+		return nil, err
+	}
+	cherryPicks, err := r.FindCherryPicks(ctx, targetRange)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sha := range candidates {
+		if targetSHA, found := cherryPicks[sha]; found {
+			klog.V(2).Infof("commit %s was cherry-picked to %q as %s", sha, target, targetSHA)
+			present[sha] = targetSHA
+			continue
+		}
+
+		patchID, err := r.CommitPatchID(ctx, sha, landed.Mainline)
+		if err != nil {
+			return nil, err
+		}
+		if patchID == "" {
+			continue
+		}
+		if targetSHA, found := targetPatchIDs[patchID]; found {
+			klog.V(2).Infof("commit %s is already present on %q as %s", sha, target, targetSHA)
+			present[sha] = targetSHA
+		}
+	}
+	return present, nil
+}
@@ -1,9 +1,13 @@
 package git
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 
@@ -19,6 +23,11 @@ type GithubForgeInfo struct {
 	Repository   string
 }
 
+// PullRequestURL returns the web url of the pull request with the given number.
+func (i *GithubForgeInfo) PullRequestURL(number string) string {
+	return "https://github.com/" + i.Organization + "/" + i.Repository + "/pull/" + number
+}
+
 func ParseRepoFromURL(ctx context.Context, s string) ForgeInfo {
 	if strings.HasPrefix(s, "https://github.com/") {
 		s = strings.TrimSuffix(s, ".git")
@@ -54,6 +63,34 @@ func ParseRepoFromURL(ctx context.Context, s string) ForgeInfo {
 	return nil
 }
 
+// ParsePullRequestID accepts a pull request number or url, returning the number.
+// A url must be for a pull request on this remote's repository.
+func (r *Remote) ParsePullRequestID(ctx context.Context, s string) (string, error) {
+	s = strings.TrimPrefix(s, "#")
+	if _, err := strconv.Atoi(s); err == nil {
+		return s, nil
+	}
+
+	u, err := url.Parse(s)
+	if err == nil {
+		// https://github.com/<org>/<repo>/pull/<number>
+		tokens := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(tokens) >= 4 && tokens[2] == "pull" {
+			if _, err := strconv.Atoi(tokens[3]); err == nil {
+				info, err := r.GithubInfo(ctx)
+				if err != nil {
+					return "", err
+				}
+				if !strings.EqualFold(tokens[0], info.Organization) || !strings.EqualFold(tokens[1], info.Repository) {
+					return "", fmt.Errorf("pull request %q is not for %s/%s (the repository of remote %q)", s, info.Organization, info.Repository, r.Name)
+				}
+				return tokens[3], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot parse pull request %q (expected number or url)", s)
+}
+
 func (r *Remote) GetPullRequest(ctx context.Context, id string) (*GithubPullRequest, error) {
 	info := ParseRepoFromURL(ctx, r.FetchURL)
 	if info == nil {
@@ -89,6 +126,184 @@ func (r *Remote) GetPullRequest(ctx context.Context, id string) (*GithubPullRequ
 	}
 }
 
+// GithubInfo returns the github organization and repository that the remote points to.
+func (r *Remote) GithubInfo(ctx context.Context) (*GithubForgeInfo, error) {
+	info := ParseRepoFromURL(ctx, r.FetchURL)
+	switch info := info.(type) {
+	case *GithubForgeInfo:
+		return info, nil
+	case nil:
+		return nil, fmt.Errorf("cannot determine forge from %q", r.FetchURL)
+	default:
+		return nil, fmt.Errorf("unknown forge type %T", info)
+	}
+}
+
+// ListPullRequestsForBranch returns the pull requests against this remote with the given head.
+// state is one of open, closed or all.
+func (r *Remote) ListPullRequestsForBranch(ctx context.Context, headOwner string, headBranch string, state string) ([]*GithubPullRequest, error) {
+	info, err := r.GithubInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := github.NewClient(nil)
+	prs, _, err := client.PullRequests.List(ctx, info.Organization, info.Repository, &github.PullRequestListOptions{
+		State: state,
+		Head:  headOwner + ":" + headBranch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pull requests from github: %w", err)
+	}
+
+	var results []*GithubPullRequest
+	for _, pr := range prs {
+		results = append(results, &GithubPullRequest{pr: pr})
+	}
+	return results, nil
+}
+
+// FindPullRequestsForCommit returns the pull requests that contain the commit.
+func (r *Remote) FindPullRequestsForCommit(ctx context.Context, sha string) ([]*GithubPullRequest, error) {
+	info, err := r.GithubInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := github.NewClient(nil)
+	prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, info.Organization, info.Repository, sha, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listing pull requests for commit %s from github: %w", sha, err)
+	}
+
+	var results []*GithubPullRequest
+	for _, pr := range prs {
+		results = append(results, &GithubPullRequest{pr: pr})
+	}
+	return results, nil
+}
+
+// FindFork returns the clone url of owner's fork of this remote's repository.
+func (r *Remote) FindFork(ctx context.Context, owner string) (string, error) {
+	info, err := r.GithubInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	client := github.NewClient(nil)
+
+	// Forks usually keep the name of the upstream repository
+	fork, _, err := client.Repositories.Get(ctx, owner, info.Repository)
+	if err != nil {
+		return "", fmt.Errorf("error fetching repository %s/%s from github: %w", owner, info.Repository, err)
+	}
+	if !fork.GetFork() {
+		return "", fmt.Errorf("repository %s/%s is not a fork", owner, info.Repository)
+	}
+	parent := fork.GetParent()
+	if !strings.EqualFold(parent.GetOwner().GetLogin(), info.Organization) || !strings.EqualFold(parent.GetName(), info.Repository) {
+		return "", fmt.Errorf("repository %s/%s is not a fork of %s/%s", owner, info.Repository, info.Organization, info.Repository)
+	}
+	return fork.GetCloneURL(), nil
+}
+
+// CommentOnPullRequest adds a comment to the pull request, using the gh tool.
+func (r *Remote) CommentOnPullRequest(ctx context.Context, prNumber int, body string) error {
+	info, err := r.GithubInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"gh", "pr", "comment", strconv.Itoa(prNumber), "--repo", info.Organization + "/" + info.Repository, "--body-file", "-"}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = strings.NewReader(body)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running %s: %w", args, err)
+	}
+	return nil
+}
+
+type CreatePullRequestOptions struct {
+	// Base is the branch (on the upstream repo) that the pull request targets
+	Base string
+	// Head is the branch holding the changes, in owner:branch form for forks
+	Head  string
+	Title string
+	Body  string
+	Draft bool
+
+	// Labels are added to the new pull request
+	Labels []string
+}
+
+// CreatePullRequest opens a new pull request using the gh tool, returning the pull request number and url.
+func (r *Remote) CreatePullRequest(ctx context.Context, opt CreatePullRequestOptions) (int, string, error) {
+	info, err := r.GithubInfo(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+
+	args := []string{"gh", "pr", "create", "--repo", info.Organization + "/" + info.Repository, "--base", opt.Base, "--head", opt.Head, "--title", opt.Title, "--body-file", "-"}
+	if opt.Draft {
+		args = append(args, "--draft")
+	}
+	for _, label := range opt.Labels {
+		args = append(args, "--label", label)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = strings.NewReader(opt.Body)
+
+	if err := cmd.Run(); err != nil {
+		return 0, "", fmt.Errorf("error running %s: %w", args, err)
+	}
+
+	// gh prints the url of the new pull request, which ends with the number
+	prURL := strings.TrimSpace(stdout.String())
+	prNumber, err := strconv.Atoi(prURL[strings.LastIndex(prURL, "/")+1:])
+	if err != nil {
+		return 0, "", fmt.Errorf("cannot determine pull request number from %q", prURL)
+	}
+	return prNumber, prURL, nil
+}
+
+type EditPullRequestOptions struct {
+	// Base, if set, retargets the pull request
+	Base string
+	// Body, if set, replaces the pull request description
+	Body string
+}
+
+// EditPullRequest updates an existing pull request using the gh tool.
+func (r *Remote) EditPullRequest(ctx context.Context, prNumber int, opt EditPullRequestOptions) error {
+	info, err := r.GithubInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"gh", "pr", "edit", strconv.Itoa(prNumber), "--repo", info.Organization + "/" + info.Repository}
+	if opt.Base != "" {
+		args = append(args, "--base", opt.Base)
+	}
+	if opt.Body != "" {
+		args = append(args, "--body-file", "-")
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = strings.NewReader(opt.Body)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running %s: %w", args, err)
+	}
+	return nil
+}
+
 type GithubPullRequest struct {
 	pr      *github.PullRequest
 	commits []*github.RepositoryCommit
@@ -102,6 +317,173 @@ func (r *GithubPullRequest) Commits() []string {
 	return shas
 }
 
+// CommitSubjects returns the first line of the message of each commit in the pull request.
+func (r *GithubPullRequest) CommitSubjects() []string {
+	var subjects []string
+	for _, commit := range r.commits {
+		subject, _, _ := strings.Cut(commit.GetCommit().GetMessage(), "\n")
+		subjects = append(subjects, subject)
+	}
+	return subjects
+}
+
+// MergeCommitSHA returns the sha of the merge, squash or (last) rebased commit, once merged.
+func (r *GithubPullRequest) MergeCommitSHA() string {
+	return r.pr.GetMergeCommitSHA()
+}
+
 func (r *GithubPullRequest) Title() string {
 	return r.pr.GetTitle()
 }
+
+func (r *GithubPullRequest) Number() int {
+	return r.pr.GetNumber()
+}
+
+func (r *GithubPullRequest) URL() string {
+	return r.pr.GetHTMLURL()
+}
+
+// HeadOwner returns the owner of the repository holding the pull request branch.
+func (r *GithubPullRequest) HeadOwner() string {
+	return r.pr.GetHead().GetRepo().GetOwner().GetLogin()
+}
+
+// HeadCloneURL returns the (https) clone url of the repository holding the pull request branch,
+// or "" if that repository has been deleted.
+func (r *GithubPullRequest) HeadCloneURL() string {
+	return r.pr.GetHead().GetRepo().GetCloneURL()
+}
+
+// HeadBranch returns the name of the pull request branch.
+func (r *GithubPullRequest) HeadBranch() string {
+	return r.pr.GetHead().GetRef()
+}
+
+// HeadSHA returns the sha of the last commit on the pull request branch.
+func (r *GithubPullRequest) HeadSHA() string {
+	return r.pr.GetHead().GetSHA()
+}
+
+// MaintainerCanModify returns true if the author allows maintainers to push to the pull request branch.
+func (r *GithubPullRequest) MaintainerCanModify() bool {
+	return r.pr.GetMaintainerCanModify()
+}
+
+// Labels returns the names of the labels on the pull request.
+func (r *GithubPullRequest) Labels() []string {
+	var labels []string
+	for _, label := range r.pr.Labels {
+		labels = append(labels, label.GetName())
+	}
+	return labels
+}
+
+func (r *GithubPullRequest) Body() string {
+	return r.pr.GetBody()
+}
+
+// State returns the state of the pull request, open or closed.
+func (r *GithubPullRequest) State() string {
+	return r.pr.GetState()
+}
+
+// Merged returns true if the pull request was merged (as opposed to closed without merging).
+// The list API does not populate merged, so we also check merged_at.
+func (r *GithubPullRequest) Merged() bool {
+	return r.pr.GetMerged() || !r.pr.GetMergedAt().IsZero()
+}
+
+// BaseBranch returns the name of the branch the pull request targets.
+func (r *GithubPullRequest) BaseBranch() string {
+	return r.pr.GetBase().GetRef()
+}
+
+// PullRequestStatus is the review and CI status of a pull request, as reported by gh.
+type PullRequestStatus struct {
+	Number         int    `json:"number"`
+	Title          string `json:"title"`
+	URL            string `json:"url"`
+	State          string `json:"state"`
+	IsDraft        bool   `json:"isDraft"`
+	ReviewDecision string `json:"reviewDecision"`
+	Mergeable      string `json:"mergeable"`
+	HeadRefName    string `json:"headRefName"`
+	BaseRefName    string `json:"baseRefName"`
+
+	HeadRepositoryOwner struct {
+		Login string `json:"login"`
+	} `json:"headRepositoryOwner"`
+
+	StatusCheckRollup []struct {
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+		State      string `json:"state"`
+	} `json:"statusCheckRollup"`
+}
+
+// CIState summarizes the checks into one of SUCCESS, FAILURE, PENDING, or "" if there are no checks.
+func (s *PullRequestStatus) CIState() string {
+	if len(s.StatusCheckRollup) == 0 {
+		return ""
+	}
+	pending := false
+	for _, check := range s.StatusCheckRollup {
+		// Check runs have a status and conclusion, commit statuses have a state
+		switch check.Conclusion {
+		case "FAILURE", "TIMED_OUT", "CANCELLED", "ACTION_REQUIRED", "STARTUP_FAILURE":
+			return "FAILURE"
+		}
+		switch check.State {
+		case "FAILURE", "ERROR":
+			return "FAILURE"
+		case "PENDING", "EXPECTED":
+			pending = true
+		}
+		if check.Status != "" && check.Status != "COMPLETED" {
+			pending = true
+		}
+	}
+	if pending {
+		return "PENDING"
+	}
+	return "SUCCESS"
+}
+
+// ListPullRequestStatuses returns the recent pull requests against this remote opened by author, using the gh tool.
+func (r *Remote) ListPullRequestStatuses(ctx context.Context, author string) ([]*PullRequestStatus, error) {
+	return r.listPullRequestStatuses(ctx, "--author", author, "--state", "all", "--limit", "200")
+}
+
+// SearchOpenPullRequests returns the open pull requests against this remote matching the github search query, using the gh tool.
+func (r *Remote) SearchOpenPullRequests(ctx context.Context, query string) ([]*PullRequestStatus, error) {
+	return r.listPullRequestStatuses(ctx, "--search", query, "--state", "open", "--limit", "100")
+}
+
+func (r *Remote) listPullRequestStatuses(ctx context.Context, listArgs ...string) ([]*PullRequestStatus, error) {
+	info, err := r.GithubInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := "number,title,url,state,isDraft,reviewDecision,mergeable,headRefName,baseRefName,headRepositoryOwner,statusCheckRollup"
+	args := []string{"gh", "pr", "list", "--repo", info.Organization + "/" + info.Repository}
+	args = append(args, listArgs...)
+	args = append(args, "--json", fields)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	klog.V(1).Infof("running %s", strings.Join(cmd.Args, " "))
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running %s: %w", args, err)
+	}
+
+	var statuses []*PullRequestStatus
+	if err := json.Unmarshal(stdout.Bytes(), &statuses); err != nil {
+		return nil, fmt.Errorf("error parsing gh output: %w", err)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultReleasePatterns are the release branches, unless gitflow.release.pattern is set
+var defaultReleasePatterns = []string{"main", "master", "release-*"}
+
+// BranchPatterns matches branch names against a list of patterns.
+// Each pattern is a glob (as for path.Match), or a regular expression if wrapped in slashes, e.g. /^v[0-9]+$/
+type BranchPatterns struct {
+	patterns []string
+	globs    []string
+	regexps  []*regexp.Regexp
+}
+
+// ParseBranchPatterns parses a list of glob or /regex/ patterns.
+func ParseBranchPatterns(patterns []string) (*BranchPatterns, error) {
+	p := &BranchPatterns{patterns: patterns}
+	for _, pattern := range patterns {
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid branch pattern %q: %w", pattern, err)
+			}
+			p.regexps = append(p.regexps, re)
+		} else {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid branch pattern %q: %w", pattern, err)
+			}
+			p.globs = append(p.globs, pattern)
+		}
+	}
+	return p, nil
+}
+
+// Match returns true if the branch name matches any of the patterns.
+func (p *BranchPatterns) Match(shortName string) bool {
+	for _, glob := range p.globs {
+		if match, _ := path.Match(glob, shortName); match {
+			return true
+		}
+	}
+	for _, re := range p.regexps {
+		if re.MatchString(shortName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the branches that match any of the patterns, sorted by name.
+func (p *BranchPatterns) Filter(branches []*Branch) []*Branch {
+	var matches []*Branch
+	for _, branch := range branches {
+		if p.Match(branch.ShortName) {
+			matches = append(matches, branch)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ShortName < matches[j].ShortName })
+	return matches
+}
+
+func (p *BranchPatterns) String() string {
+	return strings.Join(p.patterns, ", ")
+}
+
+// ReleaseBranchPatterns returns the patterns matching release branches (including main and master),
+// from the multi-valued gitflow.release.pattern setting.
+func (r *Repo) ReleaseBranchPatterns(ctx context.Context) (*BranchPatterns, error) {
+	return r.branchPatterns(ctx, "gitflow.release.pattern", defaultReleasePatterns)
+}
+
+// ProtectedBranchPatterns returns the patterns matching branches that must never be deleted,
+// from the multi-valued gitflow.protected setting.  Release branches are always protected as well.
+func (r *Repo) ProtectedBranchPatterns(ctx context.Context) (*BranchPatterns, error) {
+	return r.branchPatterns(ctx, "gitflow.protected", nil)
+}
+
+func (r *Repo) branchPatterns(ctx context.Context, key string, defaults []string) (*BranchPatterns, error) {
+	config, err := r.ListConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting repo config: %w", err)
+	}
+	patterns := config.GetAll(key)
+	if len(patterns) == 0 {
+		patterns = defaults
+	}
+	p, err := ParseBranchPatterns(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", key, err)
+	}
+	return p, nil
+}
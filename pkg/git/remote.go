@@ -92,6 +92,64 @@ func (r *Remote) Fetch(ctx context.Context) error {
 	return nil
 }
 
+// FetchBranch fetches a single branch from the remote, updating the remote-tracking ref.
+func (r *Remote) FetchBranch(ctx context.Context, shortName string) error {
+	repo := r.repo
+	result, err := repo.ExecGit(ctx, "fetch", r.Name, shortName)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+
+		return err
+	}
+	return nil
+}
+
+// DeleteBranch deletes the branch on the remote, along with our remote-tracking ref.
+func (r *Remote) DeleteBranch(ctx context.Context, shortName string) error {
+	repo := r.repo
+	result, err := repo.ExecGit(ctx, "push", r.Name, "--delete", shortName)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return err
+	}
+	return nil
+}
+
+// Prune removes the remote-tracking refs for branches that no longer exist on the remote.
+// It returns the refs that were (or with dryRun, would be) removed.
+func (r *Remote) Prune(ctx context.Context, dryRun bool) ([]string, error) {
+	repo := r.repo
+	args := []string{"remote", "prune"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, r.Name)
+	result, err := repo.ExecGit(ctx, args...)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	// Output lines look like " * [pruned] origin/foo" (or [would prune])
+	var pruned []string
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "* [") {
+			continue
+		}
+		if _, ref, found := strings.Cut(line, "] "); found {
+			pruned = append(pruned, strings.TrimSpace(ref))
+		}
+	}
+	return pruned, nil
+}
+
 func (r *Remote) Rename(ctx context.Context, newName string) error {
 	log := klog.FromContext(ctx)
 	log.Info("renaming remote", "oldName", r.Name, "newName", newName)
@@ -140,3 +198,83 @@ func (r *Remote) UpdateURLs(ctx context.Context, fetchURL string, pushURL string
 
 	return nil
 }
+
+// IsSameRepo returns true if the two urls refer to the same repository on the same forge
+func IsSameRepo(ctx context.Context, url1, url2 string) bool {
+	if url1 == url2 {
+		return true
+	}
+	info1, ok1 := ParseRepoFromURL(ctx, url1).(*GithubForgeInfo)
+	info2, ok2 := ParseRepoFromURL(ctx, url2).(*GithubForgeInfo)
+	if !ok1 || !ok2 {
+		return false
+	}
+	return strings.EqualFold(info1.Organization, info2.Organization) && strings.EqualFold(info1.Repository, info2.Repository)
+}
+
+// FindOrAddRemote returns the remote for fetchURL, adding a remote with the given name if there is none.
+// Before adding a remote, the upstream and fork remotes are recorded in config if they are not already set.
+func (r *Repo) FindOrAddRemote(ctx context.Context, name string, fetchURL string) (*Remote, error) {
+	log := klog.FromContext(ctx)
+
+	remotes, err := r.ListRemotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range remotes {
+		if IsSameRepo(ctx, remote.FetchURL, fetchURL) {
+			return remote, nil
+		}
+	}
+
+	if existing := remotes[name]; existing != nil {
+		return nil, fmt.Errorf("remote %q already exists with url %q, expected %q", name, existing.FetchURL, fetchURL)
+	}
+
+	// Adding a remote would make the upstream and fork remotes ambiguous, if they were chosen because there was only one
+	if err := r.pinPullRequestRemotes(ctx); err != nil {
+		return nil, err
+	}
+
+	log.Info("adding remote", "remote", name, "url", fetchURL)
+	result, err := r.ExecGit(ctx, "remote", "add", name, fetchURL)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+
+		return nil, err
+	}
+
+	return r.GetRemote(ctx, name)
+}
+
+// pinPullRequestRemotes records gitflow.upstream.remote and gitflow.fork.remote, if they are unset
+// and there is only one remote (so the choice is currently implicit).
+func (r *Repo) pinPullRequestRemotes(ctx context.Context) error {
+	log := klog.FromContext(ctx)
+
+	config, err := r.ListConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting repo config: %w", err)
+	}
+	remotes, err := r.ListRemotes(ctx)
+	if err != nil {
+		return err
+	}
+	if len(remotes) != 1 {
+		return nil
+	}
+	for _, remote := range remotes {
+		for _, key := range []string{"gitflow.upstream.remote", "gitflow.fork.remote"} {
+			if config.Get(key) != "" {
+				continue
+			}
+			log.Info("recording remote in config", "key", key, "remote", remote.Name)
+			if err := r.SetConfig(ctx, key, remote.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"k8s.io/klog/v2"
@@ -26,16 +27,21 @@ func OpenRepo(ctx context.Context) (*Repo, error) {
 		return nil, fmt.Errorf("error getting current directory: %w", err)
 	}
 
+	return OpenRepoAt(ctx, cwd)
+}
+
+// OpenRepoAt opens the repo (or worktree) containing dir.
+func OpenRepoAt(ctx context.Context, dir string) (*Repo, error) {
 	// TODO: Find root?
-	p := cwd
+	p := dir
 
-	r := &Repo{Dir: cwd}
+	r := &Repo{Dir: dir}
 	// We list config as a quick check that this is a real git directory
 	config, err := r.ListConfig(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open git repo %q: %w", p, err)
 	}
-	return &Repo{Dir: cwd, config: config}, nil
+	return &Repo{Dir: dir, config: config}, nil
 }
 
 func (r *Repo) GetRemote(ctx context.Context, remoteName string) (*Remote, error) {
@@ -73,6 +79,27 @@ func (r *Repo) SetConfig(ctx context.Context, k, v string) error {
 		return err
 	}
 
+	// Force a reload on next use
+	r.config = nil
+	return nil
+}
+
+func (r *Repo) UnsetConfig(ctx context.Context, k string) error {
+	result, err := r.ExecGit(ctx, "config", "--unset-all", k)
+	if err != nil {
+		// Exit code 5 means the key was not set
+		if result.ExitCode == 5 {
+			return nil
+		}
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+
+		return err
+	}
+
+	// Force a reload on next use
+	r.config = nil
 	return nil
 }
 
@@ -217,6 +244,33 @@ func (r *Repo) CheckoutNewBranch(ctx context.Context, newBranchName string, from
 	return &Branch{Name: newBranchName, ShortName: newBranchName}, nil
 }
 
+// TODO: Maybe put this on a workdir object?
+func (r *Repo) CheckoutResetBranch(ctx context.Context, branchName string, fromBranch *Branch) (*Branch, error) {
+	_, err := r.ExecGit(ctx, "checkout", "-B", branchName, fromBranch.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Branch{Name: branchName, ShortName: branchName}, nil
+}
+
+// CreateTrackingBranch creates a branch tracking the remote branch, without checking it out.
+func (r *Repo) CreateTrackingBranch(ctx context.Context, newBranchName string, remoteBranch *Branch) (*Branch, error) {
+	_, err := r.ExecGit(ctx, "branch", "--track", newBranchName, remoteBranch.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Branch{Name: newBranchName, ShortName: newBranchName}, nil
+}
+
+// TODO: Maybe put this on a workdir object?
+func (r *Repo) CheckoutTrackingBranch(ctx context.Context, newBranchName string, remoteBranch *Branch) (*Branch, error) {
+	_, err := r.ExecGit(ctx, "checkout", "--track", "-b", newBranchName, remoteBranch.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Branch{Name: newBranchName, ShortName: newBranchName}, nil
+}
+
 // TODO: Maybe put this on a workdir object?
 func (r *Repo) Checkout(ctx context.Context, branch *Branch) error {
 	_, err := r.ExecGit(ctx, "checkout", branch.Name)
@@ -228,10 +282,32 @@ func (r *Repo) Checkout(ctx context.Context, branch *Branch) error {
 
 // TODO: Maybe put this on a workdir object?
 func (r *Repo) CherryPick(ctx context.Context, shas []string) error {
+	return r.CherryPickWithOptions(ctx, shas, CherryPickOptions{})
+}
+
+type CherryPickOptions struct {
+	// Mainline is the parent number to diff against, when picking merge commits (-m)
+	Mainline int
+
+	// RecordOrigin appends "(cherry picked from commit ...)" to each message (-x)
+	RecordOrigin bool
+}
+
+// TODO: Maybe put this on a workdir object?
+func (r *Repo) CherryPickWithOptions(ctx context.Context, shas []string, opt CherryPickOptions) error {
 	args := []string{"cherry-pick"}
+	if opt.Mainline != 0 {
+		args = append(args, "-m", strconv.Itoa(opt.Mainline))
+	}
+	if opt.RecordOrigin {
+		args = append(args, "-x")
+	}
 	args = append(args, shas...)
-	_, err := r.ExecGit(ctx, args...)
+	result, err := r.ExecGit(ctx, args...)
 	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
 		return err
 	}
 	return nil
@@ -239,6 +315,12 @@ func (r *Repo) CherryPick(ctx context.Context, shas []string) error {
 
 type PushOptions struct {
 	SetUpstream bool
+
+	// ForceWithLease is passed as --force-with-lease=<value>, typically <branch>:<expected-sha>
+	ForceWithLease string
+
+	// Refspecs are the refs to push; if empty we push the current branch
+	Refspecs []string
 }
 
 // TODO: Maybe put this on a workdir object?
@@ -247,7 +329,11 @@ func (r *Repo) Push(ctx context.Context, remote *Remote, opt PushOptions) error
 	if opt.SetUpstream {
 		args = append(args, "--set-upstream")
 	}
+	if opt.ForceWithLease != "" {
+		args = append(args, "--force-with-lease="+opt.ForceWithLease)
+	}
 	args = append(args, remote.Name)
+	args = append(args, opt.Refspecs...)
 
 	result, err := r.ExecGit(ctx, args...)
 	if err != nil {
@@ -259,6 +345,15 @@ func (r *Repo) Push(ctx context.Context, remote *Remote, opt PushOptions) error
 	return nil
 }
 
+// RevParse resolves the revision to a full sha
+func (r *Repo) RevParse(ctx context.Context, rev string) (string, error) {
+	result, err := r.ExecGit(ctx, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %q: %w", rev, err)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
 func (r *Repo) FindUpstreamBranch(ctx context.Context) (*Branch, error) {
 	log := klog.FromContext(ctx)
 	upstreamRemote, err := r.FindUpstreamRemoteForPullRequests(ctx)
@@ -319,10 +414,20 @@ func (r *Repo) ExecGit(ctx context.Context, args ...string) (*ExecResult, error)
 	return execGit(ctx, r.Dir, args...)
 }
 
+// ExecGitWithInput runs git, passing input on stdin.
+func (r *Repo) ExecGitWithInput(ctx context.Context, input string, args ...string) (*ExecResult, error) {
+	return execGitWithInput(ctx, r.Dir, strings.NewReader(input), args...)
+}
+
 func (r *Repo) ExecGitInteractive(ctx context.Context, args ...string) (*ExecResult, error) {
 	return execGitInteractive(ctx, r.Dir, args...)
 }
 
+// ExecGitInteractiveWithEnv runs git interactively, with additional environment variables (KEY=VALUE).
+func (r *Repo) ExecGitInteractiveWithEnv(ctx context.Context, env []string, args ...string) (*ExecResult, error) {
+	return execGitInteractiveWithEnv(ctx, r.Dir, env, args...)
+}
+
 // type RebaseOptions struct {
 // 	Autosquash bool
 // 	Upstream   *Branch
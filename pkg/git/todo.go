@@ -0,0 +1,94 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RebaseTodoLine is a line of a rebase todo list, such as "pick <sha>" or "exec <command>"
+type RebaseTodoLine struct {
+	// Command is the todo command: pick, drop, squash, fixup or exec
+	Command string
+
+	// Arg is the sha of the commit, or the shell command for exec
+	Arg string
+}
+
+// ListBranchCommits returns the merge base of HEAD with the upstream branch, and the commits since then, oldest first.
+// These are the commits that toc lists, numbered from 1.
+func (r *Repo) ListBranchCommits(ctx context.Context, upstream *Branch) (string, []*Commit, error) {
+	base, err := r.MergeBase(ctx, upstream.Name, "HEAD")
+	if err != nil {
+		return "", nil, err
+	}
+	commits, err := r.ListCommits(ctx, base+"..HEAD")
+	if err != nil {
+		return "", nil, err
+	}
+	return base, commits, nil
+}
+
+// RebaseWithTodo runs an interactive rebase onto base, using our todo list in place of the one git generates.
+// The todo is installed through GIT_SEQUENCE_EDITOR, and squash messages are accepted as combined by git.
+// If the rebase stops (for example on a conflict), we return an error and leave the rebase in progress.
+func (r *Repo) RebaseWithTodo(ctx context.Context, base string, todo []RebaseTodoLine) error {
+	merges, err := r.ExecGit(ctx, "rev-list", "--merges", base+"..HEAD")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(merges.Stdout) != "" {
+		return fmt.Errorf("cannot rewrite history containing merge commits")
+	}
+
+	gitDir, err := r.GitDir(ctx)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(gitDir, "GITFLOW_REBASE_TODO")
+
+	var b bytes.Buffer
+	for _, line := range todo {
+		if strings.Contains(line.Arg, "\n") {
+			return fmt.Errorf("todo line %q cannot contain a newline", line.Arg)
+		}
+		fmt.Fprintf(&b, "%s %s\n", line.Command, line.Arg)
+	}
+	if err := os.WriteFile(p, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing todo %q: %w", p, err)
+	}
+	defer os.Remove(p)
+
+	env := []string{
+		"GIT_SEQUENCE_EDITOR=cp " + ShellQuote(p),
+		"GIT_EDITOR=true",
+	}
+	if _, err := r.ExecGitInteractiveWithEnv(ctx, env, "rebase", "-i", base); err != nil {
+		return r.rebaseError(ctx, err)
+	}
+	return nil
+}
+
+// ContinueRebase continues a rebase that stopped (for example at an edit line), accepting squash messages as combined.
+func (r *Repo) ContinueRebase(ctx context.Context) error {
+	if _, err := r.ExecGitInteractiveWithEnv(ctx, []string{"GIT_EDITOR=true"}, "rebase", "--continue"); err != nil {
+		return r.rebaseError(ctx, err)
+	}
+	return nil
+}
+
+// rebaseError explains how to recover when a rebase stops part way through.
+func (r *Repo) rebaseError(ctx context.Context, err error) error {
+	if operation, _ := r.InProgressOperation(ctx); operation == "rebase" {
+		return fmt.Errorf("rebase stopped; resolve the conflicts and run 'git rebase --continue', or 'git rebase --abort' to undo")
+	}
+	return err
+}
+
+// ShellQuote quotes s for use as a single word in a shell command.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,170 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+)
+
+type Worktree struct {
+	Path string
+	HEAD string
+
+	// Branch is the full ref of the checked out branch (refs/heads/...), or "" if detached
+	Branch string
+
+	Bare     bool
+	Detached bool
+
+	// Prunable is set (to the reason) if git considers the worktree stale, for example because the directory is gone
+	Prunable string
+}
+
+// BranchName returns the short name of the checked out branch, or "" if detached
+func (w *Worktree) BranchName() string {
+	return strings.TrimPrefix(w.Branch, "refs/heads/")
+}
+
+// ListWorktrees returns all the worktrees of the repository, starting with the main worktree.
+func (r *Repo) ListWorktrees(ctx context.Context) ([]*Worktree, error) {
+	result, err := r.ExecGit(ctx, "worktree", "list", "--porcelain")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return nil, err
+	}
+
+	var worktrees []*Worktree
+	var current *Worktree
+	scanner := bufio.NewScanner(strings.NewReader(result.Stdout))
+	for {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("error parsing output: %w", err)
+			}
+			break
+		}
+
+		line := scanner.Text()
+		if line == "" {
+			current = nil
+			continue
+		}
+
+		k, v, _ := strings.Cut(line, " ")
+		if k == "worktree" {
+			current = &Worktree{Path: v}
+			worktrees = append(worktrees, current)
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("error parsing line %q (expected worktree first)", line)
+		}
+		switch k {
+		case "HEAD":
+			current.HEAD = v
+		case "branch":
+			current.Branch = v
+		case "bare":
+			current.Bare = true
+		case "detached":
+			current.Detached = true
+		case "prunable":
+			current.Prunable = v
+			if current.Prunable == "" {
+				current.Prunable = "prunable"
+			}
+		}
+	}
+
+	return worktrees, nil
+}
+
+// AddWorktree checks out the (existing) branch into a new worktree at path.
+func (r *Repo) AddWorktree(ctx context.Context, p string, branch *Branch) error {
+	result, err := r.ExecGit(ctx, "worktree", "add", p, branch.Name)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return err
+	}
+	return nil
+}
+
+// AddDetachedWorktree checks out the revision into a new worktree at path, with a detached HEAD.
+func (r *Repo) AddDetachedWorktree(ctx context.Context, p string, rev string) error {
+	result, err := r.ExecGit(ctx, "worktree", "add", "--detach", p, rev)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveWorktree removes the worktree at path; force is needed if the worktree has uncommitted changes.
+func (r *Repo) RemoveWorktree(ctx context.Context, p string, force bool) error {
+	args := []string{"worktree", "remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, p)
+	result, err := r.ExecGit(ctx, args...)
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return err
+	}
+	return nil
+}
+
+// HasUncommittedChanges returns true if the working tree or index has changes, including untracked files.
+func (r *Repo) HasUncommittedChanges(ctx context.Context) (bool, error) {
+	result, err := r.ExecGit(ctx, "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(result.Stdout) != "", nil
+}
+
+// ConflictedFiles returns the paths with unresolved merge conflicts.
+func (r *Repo) ConflictedFiles(ctx context.Context) ([]string, error) {
+	result, err := r.ExecGit(ctx, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// TopLevel returns the root directory of the working tree.
+func (r *Repo) TopLevel(ctx context.Context) (string, error) {
+	result, err := r.ExecGit(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// PruneWorktrees removes the administrative files for worktrees whose directories are gone.
+func (r *Repo) PruneWorktrees(ctx context.Context) error {
+	result, err := r.ExecGit(ctx, "worktree", "prune", "--verbose")
+	if err != nil {
+		if result.ExitCode != 0 {
+			result.PrintOutput()
+		}
+		return err
+	}
+	result.PrintOutput()
+	return nil
+}